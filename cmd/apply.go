@@ -1,11 +1,13 @@
 package cmd
 
 import (
-	"context"
-	"fmt"
+	"os"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/hashmap-kz/katomik/internal/apply"
+	"github.com/hashmap-kz/katomik/internal/lock"
 
 	"github.com/spf13/pflag"
 
@@ -15,6 +17,20 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// protectedContextsEnv holds the default of --protected-contexts, so a
+// workstation can protect its production contexts once.
+const protectedContextsEnv = "KATOMIK_PROTECTED_CONTEXTS"
+
+func protectedContextsDefault() []string {
+	var patterns []string
+	for _, p := range strings.Split(os.Getenv(protectedContextsEnv), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
 // NewAtomicApplyCmd builds the root cobra.Command for atomic-apply.
 //
 // It keeps the important flags (-f/-R/--timeout) at the top and pushes the
@@ -31,8 +47,11 @@ func NewAtomicApplyCmd(streams genericiooptions.IOStreams) *cobra.Command {
 		Short:         "Atomically apply Kubernetes manifests and roll back on failure",
 		Long: `A transactional 'kubectl apply'.
 
+ * Validates manifests against OpenAPI schemas before touching the cluster
  * Applies a set of manifests in one transaction
  * Rolls back automatically if any object fails
+ * Spans several clusters (--contexts) as one transaction
+ * Locks the namespace (or --release) so concurrent runs cannot interleave
  * Waits for all resources to become Ready
 `,
 		Example: `
@@ -44,33 +63,103 @@ func NewAtomicApplyCmd(streams genericiooptions.IOStreams) *cobra.Command {
 
   # Use a specific kube-context
   katomik apply -f app.yaml --context staging
+
+  # Stream structured events to a dashboard
+  katomik apply -f ./manifests -R -o json | deploy-dashboard ingest
+
+  # Roll out to three regional clusters, all-or-nothing
+  katomik apply -f ./release -R --contexts eu,us,ap
+
+  # Keep everything inside the team namespace
+  katomik apply -f ./manifests -R -n team-a --enforce-namespace --rewrite-namespace
+
+  # Keep a failed release in staging for debugging, revert it afterwards
+  katomik apply -f ./manifests -R --no-rollback --rollback-plan web.rollback.json
+  katomik rollback --plan web.rollback.json
+
+  # Ask before touching production, confirm without asking in CI
+  export KATOMIK_PROTECTED_CONTEXTS='prod-*'
+  katomik apply -f ./manifests -R --context prod-eu
+  katomik apply -f ./manifests -R --context prod-eu --yes
+
+  # Apply a pinned remote manifest from a private server
+  katomik apply -f 'https://artifacts.example.com/app.yaml#sha256=<hex>' --remote-token-env ARTIFACTS_TOKEN
 `,
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			if len(aa.Filenames) == 0 {
-				return fmt.Errorf("at least one --filename/-f must be specified")
+				return apply.InputError("at least one --filename/-f must be specified")
+			}
+			if len(aa.Contexts) > 0 && cfgFlags.Context != nil && *cfgFlags.Context != "" {
+				return apply.InputError("--context and --contexts are mutually exclusive")
+			}
+			if aa.Output != "" && aa.Output != apply.OutputJSON && aa.Output != apply.OutputYAML {
+				return apply.InputError("invalid --output %q: must be one of %s, %s", aa.Output, apply.OutputJSON, apply.OutputYAML)
+			}
+			if aa.DriftPolicy != apply.DriftAbort && aa.DriftPolicy != apply.DriftResnapshot {
+				return apply.InputError("invalid --on-drift %q: must be one of %s, %s", aa.DriftPolicy, apply.DriftAbort, apply.DriftResnapshot)
+			}
+			if aa.NoLock && (aa.Release != "" || aa.LockNamespace != "") {
+				return apply.InputError("--release and --lock-namespace cannot be used with --no-lock")
+			}
+			if err := checkRollbackFlags(&aa); err != nil {
+				return err
+			}
+			for _, p := range aa.ProtectedContexts {
+				if _, err := path.Match(p, ""); err != nil {
+					return apply.InputError("invalid --protected-contexts pattern %q: %w", p, err)
+				}
+			}
+			if aa.RollbackPlan != "" && !aa.NoRollback {
+				return apply.InputError("--rollback-plan requires --no-rollback")
+			}
+			switch aa.Duplicates {
+			case apply.DuplicatesError, apply.DuplicatesLastWins, apply.DuplicatesMerge:
+			default:
+				return apply.InputError("invalid --duplicates %q: must be one of %s, %s, %s",
+					aa.Duplicates, apply.DuplicatesError, apply.DuplicatesLastWins, apply.DuplicatesMerge)
 			}
 
+			aa.Quiet = isQuiet(cmd)
 			run := &apply.AtomicApplyRunOptions{
 				ConfigFlags: cfgFlags,
 				Streams:     streams,
 				ApplyOpts:   aa,
 			}
-			ctx, cancel := context.WithTimeout(cmd.Context(), aa.Timeout)
-			defer cancel()
-			return apply.RunApply(ctx, run)
+			return apply.RunApply(cmd.Context(), run)
 		},
 	}
 
 	// core flags
+	addManifestFlags(cmd, &aa, "apply")
 	f := cmd.Flags()
-	f.SortFlags = false // preserve insertion order
-
-	f.StringSliceVarP(&aa.Filenames, "filename", "f", nil, "Manifest files, glob patterns, or directories to apply.")
-	//nolint:errcheck
-	_ = cmd.MarkFlagRequired("filename")
-
-	f.BoolVarP(&aa.Recursive, "recursive", "R", false, "Recurse into directories specified with --filename.")
-	f.DurationVar(&aa.Timeout, "timeout", 5*time.Minute, "Wait timeout for resources to reach the desired state.")
+	f.DurationVar(&aa.Timeout, "timeout", 5*time.Minute, "Readiness timeout, objects may set their own with the katomik.io/timeout annotation.")
+	f.DurationVar(&aa.ApplyTimeout, "apply-timeout", 5*time.Minute, "Timeout for applying all objects, 0 for none.")
+	addRollbackFlags(cmd, &aa)
+	f.BoolVar(&aa.NoRollback, "no-rollback", false, "Keep the changes of a failed run for debugging and save the rollback plan, revert later with 'katomik rollback --plan'.")
+	f.StringVar(&aa.RollbackPlan, "rollback-plan", "", "File to save the rollback plan to with --no-rollback, defaults to katomik-rollback-<time>.json.")
+	f.BoolVar(&aa.NoWatch, "no-watch", false, "Poll the status of objects instead of watching them.")
+	f.DurationVar(&aa.PollInterval, "poll-interval", apply.DefaultPollInterval, "How often objects are polled with --no-watch or when watching is forbidden.")
+	f.BoolVar(&aa.RestartWorkloads, "restart-workloads", true, "Restart Deployments, StatefulSets and DaemonSets using a ConfigMap or Secret the run changes, as part of the transaction.")
+	f.BoolVar(&aa.Confirm, "confirm", false, "Show a summary of the plan and ask for typed confirmation before applying.")
+	f.StringSliceVar(&aa.ProtectedContexts, "protected-contexts", protectedContextsDefault(), "Kube context patterns (e.g. 'prod-*') that always require confirmation, defaults to $"+protectedContextsEnv+".")
+	f.BoolVarP(&aa.Yes, "yes", "y", false, "Do not ask for confirmation, e.g. in CI.")
+	f.StringVar(&aa.ReadinessRules, "readiness-rules", "", "YAML file with per-kind readiness and failure rules for CRs kstatus does not understand.")
+	f.StringVarP(&aa.Output, "output", "o", "", "Emit events (plan, applied, status, rollback, result) to stdout as json (one per line) or yaml; human output moves to stderr.")
+	f.StringVar(&aa.ReportJUnit, "report-junit", "", "Write a JUnit XML report (one test case per object) to this file.")
+	f.StringVar(&aa.ReportMarkdown, "report-markdown", "", "Write a Markdown summary (plan, timings, rollback) to this file, e.g. for a merge-request comment.")
+	f.BoolVar(&aa.Validate, "validate", true, "Validate manifests against OpenAPI schemas before applying.")
+	addSchemaFlags(cmd, &aa)
+	f.BoolVar(&aa.EnforceNamespace, "enforce-namespace", false, "Fail if an object would be applied outside of the target namespace (-n) or is cluster-scoped.")
+	f.BoolVar(&aa.AllowClusterScoped, "allow-cluster-scoped", false, "Allow cluster-scoped objects with --enforce-namespace.")
+	f.BoolVar(&aa.RewriteNamespace, "rewrite-namespace", false, "Move namespaced objects and references to their namespaces (e.g. RoleBinding subjects) into the target namespace.")
+	f.StringSliceVar(&aa.Contexts, "contexts", nil, "Apply to all of these kube contexts as one transaction, a failure in any cluster rolls back all of them.")
+	f.BoolVar(&aa.ParallelClusters, "parallel-clusters", false, "Apply to the clusters given with --contexts concurrently instead of one after another.")
+	f.BoolVar(&aa.NoLock, "no-lock", false, "Do not lock the target namespace (or --release); concurrent runs may interleave.")
+	f.StringVar(&aa.Release, "release", "", "Release name the lock is scoped to, by default runs lock the whole target namespace.")
+	f.StringVar(&aa.LockNamespace, "lock-namespace", "", "Namespace of the lock (a coordination.k8s.io Lease), must exist before the run; defaults to the target namespace.")
+	f.DurationVar(&aa.LockTimeout, "lock-timeout", lock.DefaultTimeout, "How long to wait for a lock held by another run.")
+	f.StringVar(&aa.DriftPolicy, "on-drift", apply.DriftAbort, "What to do if an object was changed by someone else after planning: abort (roll back) or resnapshot (take a new backup).")
+	f.StringVar(&aa.Duplicates, "duplicates", apply.DuplicatesError, "How to handle objects defined more than once: error, last-wins or merge.")
 
 	// Kubernetes connection flags (own section)
 	conn := pflag.NewFlagSet("Kubernetes connection flags", pflag.ContinueOnError)
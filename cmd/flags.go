@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/hashmap-kz/katomik/internal/apply"
+	"github.com/hashmap-kz/katomik/internal/resolve"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// addManifestFlags registers the flags describing where manifests come from
+// and which of them are used (-f/-R, filters, SOPS decryption, remote
+// fetching). They are shared by every command that reads manifests; verb
+// completes the --filename help text.
+func addManifestFlags(cmd *cobra.Command, aa *apply.AtomicApplyOptions, verb string) {
+	f := cmd.Flags()
+	f.SortFlags = false // preserve insertion order
+
+	// not marked required: the commands check it themselves so the error
+	// carries apply.ExitInput
+	f.StringSliceVarP(&aa.Filenames, "filename", "f", nil, "Manifest files, glob patterns, or directories to "+verb+".")
+
+	f.BoolVarP(&aa.Recursive, "recursive", "R", false, "Recurse into directories specified with --filename.")
+	f.StringVarP(&aa.Selector, "selector", "l", "", "Label selector, only matching objects are used (e.g. -l tier=frontend,env!=dev).")
+	f.StringSliceVar(&aa.OnlyKinds, "only-kinds", nil, "Only use objects of these kinds, as Kind or Kind.group (e.g. Deployment,Service).")
+	f.StringSliceVar(&aa.ExcludeKinds, "exclude-kinds", nil, "Skip objects of these kinds, as Kind or Kind.group (e.g. CustomResourceDefinition).")
+	f.StringVar(&aa.AgeKeyFile, "sops-age-key-file", "", "File with age identities to decrypt SOPS-encrypted manifests, used instead of the identities of the environment (SOPS_AGE_KEY, SOPS_AGE_KEY_FILE).")
+
+	// remote manifests (own section)
+	remote := pflag.NewFlagSet("Remote manifest flags", pflag.ContinueOnError)
+	remote.DurationVar(&aa.Remote.Timeout, "remote-timeout", resolve.DefaultRemoteTimeout, "Timeout for a single request fetching a remote manifest.")
+	remote.Int64Var(&aa.Remote.MaxBodySize, "remote-max-size", resolve.DefaultRemoteMaxBodySize, "Maximum size in bytes of a remote manifest.")
+	remote.IntVar(&aa.Remote.Retries, "remote-retries", resolve.DefaultRemoteRetries, "How many times a failed remote request is retried.")
+	remote.StringArrayVar(&aa.Remote.Headers, "remote-header", nil, "Extra header for remote requests in 'Name: value' form (repeatable).")
+	remote.StringVar(&aa.Remote.TokenEnv, "remote-token-env", "", "Environment variable holding a bearer token for remote requests.")
+	remote.StringVar(&aa.Remote.TokenFile, "remote-token-file", "", "File holding a bearer token for remote requests.")
+	remote.StringVar(&aa.Remote.TokenHost, "remote-token-host", "", "Host the bearer token is sent to, required when URLs span more than one host (default: the host of the URLs).")
+	remote.StringVar(&aa.Remote.CAFile, "remote-ca-file", "", "PEM bundle with additional CAs trusted for remote requests.")
+	remote.StringArrayVar(&aa.Remote.Checksums, "checksum", nil, "Expected sha256 of a remote manifest in 'URL=SHA256' form (repeatable).")
+	cmd.Flags().AddFlagSet(remote)
+}
+
+// addSchemaFlags registers the flags controlling OpenAPI schema validation.
+func addSchemaFlags(cmd *cobra.Command, aa *apply.AtomicApplyOptions) {
+	cmd.Flags().StringSliceVar(&aa.SchemaDirs, "schema-dir", nil, "Directories with OpenAPI v3 documents and CRD manifests used for validation.")
+}
+
+// addRollbackFlags registers the flags controlling how changes are rolled
+// back, shared by 'apply' and 'rollback'.
+func addRollbackFlags(cmd *cobra.Command, aa *apply.AtomicApplyOptions) {
+	f := cmd.Flags()
+	f.DurationVar(&aa.RollbackTimeout, "rollback-timeout", 5*time.Minute, "Timeout for rolling back, 0 for none.")
+	f.StringVar(&aa.DeletePropagation, "rollback-propagation", apply.PropagationBackground, "How objects created by the run are deleted on rollback: foreground (dependents first), background or orphan (keep dependents).")
+	f.BoolVar(&aa.ForceFinalizers, "force-finalizers", false, "Clear the finalizers of objects deleted on rollback that are still terminating after --timeout (spec.finalizers too for Namespaces).")
+}
+
+// checkRollbackFlags validates the flags of addRollbackFlags.
+func checkRollbackFlags(aa *apply.AtomicApplyOptions) error {
+	switch aa.DeletePropagation {
+	case apply.PropagationForeground, apply.PropagationBackground, apply.PropagationOrphan:
+		return nil
+	default:
+		return apply.InputError("invalid --rollback-propagation %q: must be one of %s, %s, %s",
+			aa.DeletePropagation, apply.PropagationForeground, apply.PropagationBackground, apply.PropagationOrphan)
+	}
+}
+
+// isQuiet reports whether --quiet was given to the root command.
+func isQuiet(cmd *cobra.Command) bool {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	return quiet
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/hashmap-kz/katomik/internal/apply"
+	"github.com/hashmap-kz/katomik/internal/lock"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+
+	"github.com/spf13/cobra"
+)
+
+// NewRollbackCmd builds the 'rollback' command which reverts a run that
+// failed with --no-rollback, from the rollback plan it saved.
+func NewRollbackCmd(streams genericiooptions.IOStreams) *cobra.Command {
+	cfgFlags := genericclioptions.NewConfigFlags(true)
+	aa := apply.AtomicApplyOptions{}
+
+	cmd := &cobra.Command{
+		Use:           "rollback",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		Short:         "Revert a failed run kept with --no-rollback",
+		Long: `Rolls back a run of 'katomik apply --no-rollback' from the rollback plan it saved.
+
+Objects the run created are deleted, the ones it changed are restored from
+their backups and the result is verified, exactly like an automatic rollback.
+The clusters and the lock are the ones of the run; the plan file holds the
+backups, Secrets included, so delete it once the run is reverted.
+`,
+		Example: `
+  # Revert a run kept for debugging
+  katomik rollback --plan katomik-rollback-20250101T120000Z.json
+`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if aa.RollbackPlan == "" {
+				return apply.InputError("--plan must be specified")
+			}
+			if aa.Output != "" && aa.Output != apply.OutputJSON && aa.Output != apply.OutputYAML {
+				return apply.InputError("invalid --output %q: must be one of %s, %s", aa.Output, apply.OutputJSON, apply.OutputYAML)
+			}
+			if err := checkRollbackFlags(&aa); err != nil {
+				return err
+			}
+
+			aa.Quiet = isQuiet(cmd)
+			run := &apply.AtomicApplyRunOptions{
+				ConfigFlags: cfgFlags,
+				Streams:     streams,
+				ApplyOpts:   aa,
+			}
+			return apply.RunRollback(cmd.Context(), run)
+		},
+	}
+
+	f := cmd.Flags()
+	f.SortFlags = false
+	f.StringVar(&aa.RollbackPlan, "plan", "", "Rollback plan saved by 'katomik apply --no-rollback'.")
+	f.DurationVar(&aa.Timeout, "timeout", 5*time.Minute, "How long to wait for deleted objects to go away and restored ones to become Current.")
+	addRollbackFlags(cmd, &aa)
+	f.BoolVar(&aa.NoWatch, "no-watch", false, "Poll the status of objects instead of watching them.")
+	f.DurationVar(&aa.PollInterval, "poll-interval", apply.DefaultPollInterval, "How often objects are polled with --no-watch or when watching is forbidden.")
+	f.StringVar(&aa.ReadinessRules, "readiness-rules", "", "YAML file with per-kind readiness and failure rules for CRs kstatus does not understand.")
+	f.StringVarP(&aa.Output, "output", "o", "", "Emit events (rollback, verify, result) to stdout as json (one per line) or yaml; human output moves to stderr.")
+	f.DurationVar(&aa.LockTimeout, "lock-timeout", lock.DefaultTimeout, "How long to wait for the lock if the run was locked.")
+
+	// Kubernetes connection flags (own section); the context comes from the plan
+	conn := pflag.NewFlagSet("Kubernetes connection flags", pflag.ContinueOnError)
+	cfgFlags.AddFlags(conn)
+	cmd.Flags().AddFlagSet(conn)
+
+	return cmd
+}
@@ -1,22 +1,45 @@
 package cmd
 
 import (
+	"github.com/hashmap-kz/katomik/internal/apply"
+	"github.com/hashmap-kz/katomik/internal/logging"
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericiooptions"
 )
 
 func NewRootCmd(streams genericiooptions.IOStreams) *cobra.Command {
+	logOpts := logging.Options{}
+
 	rootCmd := &cobra.Command{
 		Use:           "katomik",
 		Short:         "Atomic apply of multiple Kubernetes manifests with rollback on failure.",
 		SilenceErrors: true,
 		SilenceUsage:  true,
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			// the diagnostic log goes to stderr, whatever the output format
+			if err := logging.Setup(streams.ErrOut, logOpts); err != nil {
+				return apply.InputError("%w", err)
+			}
+			return nil
+		},
 	}
+	rootCmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return apply.InputError("%w", err)
+	})
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 	rootCmd.SetHelpCommand(&cobra.Command{
 		Use:    "no-help",
 		Hidden: true,
 	})
+
+	f := rootCmd.PersistentFlags()
+	f.StringVarP(&logOpts.Level, "log-level", "v", "", "Log level: error, warn, info, debug or a number (6 logs API requests, 8 their bodies). Defaults to warn.")
+	f.StringVar(&logOpts.Format, "log-format", logging.FormatText, "Log format: text or json.")
+	f.BoolVarP(&logOpts.Quiet, "quiet", "q", false, "Print nothing but errors (and the -o event stream).")
+
 	rootCmd.AddCommand(NewAtomicApplyCmd(streams))
+	rootCmd.AddCommand(NewValidateCmd(streams))
+	rootCmd.AddCommand(NewRollbackCmd(streams))
+	rootCmd.AddCommand(NewUnlockCmd(streams))
 	return rootCmd
 }
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"github.com/hashmap-kz/katomik/internal/apply"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+
+	"github.com/spf13/cobra"
+)
+
+// NewUnlockCmd builds the 'unlock' command which removes a stale lock left
+// behind by a run that was killed before it could release it.
+func NewUnlockCmd(streams genericiooptions.IOStreams) *cobra.Command {
+	cfgFlags := genericclioptions.NewConfigFlags(true)
+	aa := apply.AtomicApplyOptions{}
+
+	cmd := &cobra.Command{
+		Use:           "unlock",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		Short:         "Remove a stale lock held by another katomik run",
+		Long: `Deletes the Lease katomik uses to serialize runs, regardless of its holder.
+
+Locks of killed runs expire on their own once they are not renewed anymore;
+use this command only if you are sure the holder is gone.
+`,
+		Example: `
+  # Remove the namespace-wide lock in team-a
+  katomik unlock -n team-a
+
+  # Remove the lock of a release
+  katomik unlock -n team-a --release web
+`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			aa.Quiet = isQuiet(cmd)
+			run := &apply.AtomicApplyRunOptions{
+				ConfigFlags: cfgFlags,
+				Streams:     streams,
+				ApplyOpts:   aa,
+			}
+			return apply.RunUnlock(cmd.Context(), run)
+		},
+	}
+
+	f := cmd.Flags()
+	f.SortFlags = false
+	f.StringVar(&aa.Release, "release", "", "Release name the lock is scoped to, empty for the namespace-wide lock.")
+	f.StringVar(&aa.LockNamespace, "lock-namespace", "", "Namespace of the lock, defaults to the namespace given with -n.")
+
+	// Kubernetes connection flags (own section)
+	conn := pflag.NewFlagSet("Kubernetes connection flags", pflag.ContinueOnError)
+	cfgFlags.AddFlags(conn)
+	cmd.Flags().AddFlagSet(conn)
+
+	return cmd
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"github.com/hashmap-kz/katomik/internal/apply"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+
+	"github.com/spf13/cobra"
+)
+
+// NewValidateCmd builds the 'validate' command which checks manifests against
+// OpenAPI schemas without changing anything in the cluster.
+func NewValidateCmd(streams genericiooptions.IOStreams) *cobra.Command {
+	cfgFlags := genericclioptions.NewConfigFlags(true)
+	aa := apply.AtomicApplyOptions{}
+	var offline bool
+
+	cmd := &cobra.Command{
+		Use:           "validate",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		Short:         "Validate Kubernetes manifests against OpenAPI schemas",
+		Long: `Validates manifests against OpenAPI v3 schemas without applying them.
+
+Schemas are taken from the cluster (/openapi/v3), from --schema-dir directories
+(OpenAPI v3 documents and CRD manifests) and from CRDs in the manifest set.
+With --offline the cluster is never contacted.
+`,
+		Example: `
+  # Validate against the schemas of the current cluster
+  katomik validate -f ./manifests -R
+
+  # Validate fully offline with stored schemas and CRDs
+  kubectl get --raw /openapi/v3/apis/apps/v1 > schemas/apps-v1.json
+  katomik validate -f ./manifests -R --offline --schema-dir ./schemas
+`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if len(aa.Filenames) == 0 {
+				return apply.InputError("at least one --filename/-f must be specified")
+			}
+
+			aa.Quiet = isQuiet(cmd)
+			run := &apply.AtomicApplyRunOptions{
+				ConfigFlags: cfgFlags,
+				Streams:     streams,
+				ApplyOpts:   aa,
+			}
+			if offline {
+				run.ConfigFlags = nil
+			}
+			return apply.RunValidate(cmd.Context(), run)
+		},
+	}
+
+	addManifestFlags(cmd, &aa, "validate")
+	addSchemaFlags(cmd, &aa)
+	cmd.Flags().BoolVar(&offline, "offline", false, "Do not contact the cluster, use --schema-dir and CRDs from the manifest set only.")
+
+	// Kubernetes connection flags (own section)
+	conn := pflag.NewFlagSet("Kubernetes connection flags", pflag.ContinueOnError)
+	cfgFlags.AddFlags(conn)
+	cmd.Flags().AddFlagSet(conn)
+
+	return cmd
+}
@@ -13,11 +13,22 @@
 //
 // A high‑level flow looks like this:
 //
-//   - readDocs()    -> YAML/JSON -> []*unstructured.Unstructured
-//   - prepareApplyPlan()         -> []applyItem (backup & CRUD plan)
+//   - newClusters()              -> clients per target kube context
+//   - readDocs()    -> YAML/JSON -> []utils.Document
+//   - filterDocs()               -> label selector & kind filters
+//   - validateDocs()             -> offline OpenAPI schema checks
+//   - acquireLocks()             -> coordination.k8s.io Lease per cluster
+//   - prepareApplyPlan()         -> []applyItem per cluster (backup & CRUD plan)
+//   - planDependants()           -> backup of custom resources of updated CRDs
+//   - planRestarts()             -> restart workloads using changed configs
+//   - planUnchanged()            -> server-side dry-run, skip no-op updates
+//   - confirmPlan()              -> typed confirmation for protected contexts
 //   - applyPlanned()             -> Patch/Update/Delete via dynamic client
-//   - waitStatus()               -> poll until Current or timeout
-//   - rollbackAndExit() on any error
+//   - waitStatus()               -> watch until Current or timeout (live view on a TTY)
+//   - rollback() on any error, in every cluster (see ExitCode)
+//   - keepChanges() instead with NoRollback -> rollback plan for RunRollback
+//   - verifyRollback()           -> deleted objects gone, restored ones Current
+//     and equal to their backup
 //
 // The package is meant to be used from a kubectl‑style CLI, therefore it
 // relies on the same cli‑runtime helpers and accepts genericclioptions flags.
@@ -30,12 +41,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"sort"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/aquasecurity/table"
-	"github.com/hashmap-kz/katomik/internal/printer"
 	"github.com/hashmap-kz/katomik/internal/utils"
 
 	"k8s.io/apimachinery/pkg/types"
@@ -44,24 +54,20 @@ import (
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/genericiooptions"
 
+	"github.com/hashmap-kz/katomik/internal/readiness"
 	"github.com/hashmap-kz/katomik/internal/resolve"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/discovery"
-	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
-	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/restmapper"
-	"sigs.k8s.io/cli-utils/pkg/kstatus/polling"
 	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/aggregator"
 	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/collector"
 	pollEvent "sigs.k8s.io/cli-utils/pkg/kstatus/polling/event"
 	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
 	"sigs.k8s.io/cli-utils/pkg/object"
-	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // applyItem is an internal representation of a single resource that should be
@@ -70,39 +76,195 @@ import (
 //
 // Fields:
 //
-//	obj     - desired state decoded from the manifest
-//	dr      - dynamic client scoped to the resource
-//	existed - whether the object was present before the run started
-//	backup  - original JSON of the resource (only if existed=true)
-//	rv      - original resourceVersion (used to preserve concurrency semantics)
+//	obj       - desired state decoded from the manifest
+//	dr        - dynamic client scoped to the resource
+//	existed   - whether the object was present before the run started
+//	backup    - original JSON of the resource (only if existed=true)
+//	rv        - original resourceVersion (used to preserve concurrency semantics)
+//	src       - file, document and line the object was decoded from
+//	drift     - changes made by someone else between planning and applying,
+//	            empty if there were none (see checkDrift)
+//	applied   - whether the object was applied successfully
+//	undone    - what rollback() did with the object (ActionRestore or
+//	            ActionDelete), empty if nothing
+//	restart   - changed ConfigMaps and Secrets ("Kind/name") the workload is
+//	            restarted for (see planRestarts)
+//	deps      - backed up custom resources of an updated CRD (see
+//	            planDependants)
+//	unchanged - applying would not change the existing object, it is
+//	            skipped (see planUnchanged)
+//	managed   - fields of the existing object owned by the apply of
+//	            fieldManager (see managedFields)
 //
 // All fields are populated by prepareApplyPlan() and consumed by applyPlanned()
-// and rollbackAndExit().
+// and rollback().
 //
 // The struct is intentionally kept small so a slice of items can be passed
 // around without heavy copying.
 type applyItem struct {
-	obj     *unstructured.Unstructured
-	dr      dynamic.ResourceInterface
-	existed bool
-	backup  []byte
-	rv      string
+	obj       *unstructured.Unstructured
+	dr        dynamic.ResourceInterface
+	existed   bool
+	backup    []byte
+	rv        string
+	src       utils.Source
+	drift     string
+	applied   bool
+	undone    string
+	restart   []string
+	deps      *dependants
+	unchanged bool
+	managed   []byte
+}
+
+// ref identifies the item in events.
+func (it *applyItem) ref() *ObjectRef {
+	return &ObjectRef{
+		APIVersion: it.obj.GetAPIVersion(),
+		Kind:       it.obj.GetKind(),
+		Namespace:  it.obj.GetNamespace(),
+		Name:       it.obj.GetName(),
+	}
+}
+
+// action tells whether applying the item creates, updates or leaves the
+// object unchanged.
+func (it *applyItem) action() string {
+	if it.unchanged {
+		return ActionUnchanged
+	}
+	if it.existed {
+		return ActionUpdate
+	}
+	return ActionCreate
+}
+
+// String identifies the item in messages as "Kind/name (source)".
+func (it *applyItem) String() string {
+	kn := fmt.Sprintf("%s/%s", it.obj.GetKind(), it.obj.GetName())
+	if s := it.src.String(); s != "" {
+		return fmt.Sprintf("%s (%s)", kn, s)
+	}
+	return kn
 }
 
 // AtomicApplyOptions groups the user‑visible flags of the CLI layer.
 // It purposely contains **only plain data** so it can be embedded in higher
 // level option structs or reused in tests.
 //
-//	Filenames - list of paths or "-" for stdin
-//	Timeout   - maximum time to wait for resources to become Current
-//	Recursive - whether to walk directories recursively when expanding -f
-//	            arguments.
+//	Filenames          - list of paths or "-" for stdin
+//	Timeout            - maximum time to wait for resources to become Current,
+//	                     objects may set their own (katomik.io/timeout)
+//	ApplyTimeout       - maximum time for applying all objects, 0 for none
+//	RollbackTimeout    - maximum time for rolling back, 0 for none
+//	DeletePropagation  - propagation policy for objects deleted on rollback,
+//	                     one of PropagationXXX, the resource default if empty
+//	ForceFinalizers    - clear the finalizers of objects deleted on rollback
+//	                     that are still terminating after the wait
+//	NoRollback         - keep the changes of a failed run and save the
+//	                     rollback plan instead of rolling back (see RunRollback)
+//	RollbackPlan       - file the rollback plan is saved to with NoRollback,
+//	                     read by RunRollback; a timestamped name if empty
+//	NoWatch            - poll the status of objects instead of watching them
+//	PollInterval       - how often objects are polled with NoWatch or when
+//	                     watching is forbidden, DefaultPollInterval if 0
+//	Recursive          - whether to walk directories recursively when expanding -f
+//	                     arguments.
+//	Remote             - HTTP client settings for manifests referenced by URL
+//	AgeKeyFile         - age identities used to decrypt SOPS-encrypted manifests
+//	                     (in place of the ones of the environment)
+//	Validate           - validate manifests against OpenAPI schemas before applying
+//	SchemaDirs         - directories with OpenAPI v3 documents and CRDs used for
+//	                     validation (in addition to the cluster schemas)
+//	Duplicates         - how objects defined more than once are handled, one of
+//	                     DuplicatesError (default), DuplicatesLastWins, DuplicatesMerge
+//	Selector           - label selector, objects that do not match are skipped
+//	OnlyKinds          - if set, only objects of these kinds (Kind or Kind.group) are kept
+//	ExcludeKinds       - objects of these kinds are skipped
+//	EnforceNamespace   - fail for objects outside of the target namespace (-n)
+//	AllowClusterScoped - with EnforceNamespace, accept cluster-scoped objects
+//	RewriteNamespace   - move namespaced objects (and references to their
+//	                     namespaces) into the target namespace
+//	Contexts           - kube contexts to apply to as one transaction, empty
+//	                     for the current context
+//	ParallelClusters   - apply to all Contexts concurrently instead of in order
+//	NoLock             - do not take the release Lease that keeps concurrent
+//	                     runs from interleaving (see package lock)
+//	Release            - release name the Lease is scoped to, empty for the
+//	                     whole namespace
+//	LockNamespace      - namespace of the Lease, defaults to the target namespace
+//	LockTimeout        - how long to wait for a Lease held by another run
+//	DriftPolicy        - what to do with objects changed by someone else
+//	                     between planning and applying, DriftAbort (default)
+//	                     or DriftResnapshot
+//	Output             - machine-readable event stream on stdout, OutputJSON
+//	                     or OutputYAML; empty for human-oriented output only
+//	ReportJUnit        - file to write a JUnit XML report to (one test case
+//	                     per object)
+//	ReportMarkdown     - file to write a Markdown summary to (plan, timings,
+//	                     rollback)
+//	Quiet              - suppress human-oriented output; the error and the
+//	                     Output stream are kept
+//	ReadinessRules     - file with per-kind readiness and failure rules (see
+//	                     package readiness), annotations take precedence
+//	RestartWorkloads   - restart Deployments, StatefulSets and DaemonSets using
+//	                     a ConfigMap or Secret the run changes
+//	Confirm            - ask for typed confirmation of the plan before applying
+//	ProtectedContexts  - context name patterns (path.Match) that require the
+//	                     confirmation, e.g. "prod-*"
+//	Yes                - confirm without asking, e.g. in CI
 type AtomicApplyOptions struct {
-	Filenames []string
-	Timeout   time.Duration
-	Recursive bool
+	Filenames          []string
+	Timeout            time.Duration
+	ApplyTimeout       time.Duration
+	RollbackTimeout    time.Duration
+	DeletePropagation  string
+	ForceFinalizers    bool
+	NoRollback         bool
+	RollbackPlan       string
+	NoWatch            bool
+	PollInterval       time.Duration
+	Recursive          bool
+	Remote             resolve.RemoteOptions
+	AgeKeyFile         string
+	Validate           bool
+	SchemaDirs         []string
+	Duplicates         string
+	Selector           string
+	OnlyKinds          []string
+	ExcludeKinds       []string
+	EnforceNamespace   bool
+	AllowClusterScoped bool
+	RewriteNamespace   bool
+	Contexts           []string
+	ParallelClusters   bool
+	NoLock             bool
+	Release            string
+	LockNamespace      string
+	LockTimeout        time.Duration
+	DriftPolicy        string
+	Output             string
+	ReportJUnit        string
+	ReportMarkdown     string
+	Quiet              bool
+	ReadinessRules     string
+	RestartWorkloads   bool
+	Confirm            bool
+	ProtectedContexts  []string
+	Yes                bool
 }
 
+// Modes for objects that are defined more than once in the manifest set.
+//
+//	DuplicatesError    - fail before anything is applied
+//	DuplicatesLastWins - the definition read last replaces the earlier ones
+//	DuplicatesMerge    - definitions are deep-merged, conflicting values fail
+const (
+	DuplicatesError    = "error"
+	DuplicatesLastWins = "last-wins"
+	DuplicatesMerge    = "merge"
+)
+
 // AtomicApplyRunOptions wires together everything required to run the high
 // level algorithm (config flags, IO streams and the user flags above).
 //
@@ -122,206 +284,415 @@ type AtomicApplyRunOptions struct {
 
 // RunApply is the public entry‑point. It orchestrates the full lifecycle:
 // parsing manifests, creating a plan, applying, waiting for readiness and
-// rolling back on failure.
+// rolling back on failure. With ApplyOpts.Contexts the lifecycle spans several
+// clusters as one transaction: a failure in any of them rolls back all.
 //
 //	ctx     - context that can enforce an overall deadline/cancelation
 //	runOpts - fully populated AtomicApplyRunOptions
 //
-// It returns nil on success or an error if *any* step failed. When the function
-// returns an error, it is guaranteed that rollbackAndExit has *already* been
-// invoked or rollback itself failed (the latter is included in the returned
-// error chain).
-func RunApply(ctx context.Context, runOpts *AtomicApplyRunOptions) error {
-	// 1. Build REST config & clients
-	cfg, err := runOpts.ConfigFlags.ToRESTConfig()
+// It returns nil on success or an error if *any* step failed. The error
+// carries the exit code of the failure class (see ExitCode): whether nothing
+// was touched, everything was rolled back, or rolling back failed as well (the
+// latter is included in the returned error chain).
+func RunApply(ctx context.Context, runOpts *AtomicApplyRunOptions) (err error) {
+	rep := newReporter(runOpts.Streams, runOpts.ApplyOpts.Output).
+		withQuiet(runOpts.ApplyOpts.Quiet).
+		withReports(runOpts.ApplyOpts.ReportJUnit, runOpts.ApplyOpts.ReportMarkdown)
+	var clusters []*cluster
+	rolledBack := false
+	defer func() {
+		rep.result(clusters, err, rolledBack)
+	}()
+
+	// 1. Build REST config & clients for every target cluster
+	clusters, err = newClusters(runOpts, rep)
 	if err != nil {
-		return err
+		return withExitCode(ExitInput, err)
 	}
-	// Tune client QPS/Burst
-	cfg.QPS = 50
-	cfg.Burst = 100
 
-	dyn, err := dynamic.NewForConfig(cfg)
+	// 2. Decode all manifest files or stdin
+	docs, err := readDocs(ctx, runOpts)
 	if err != nil {
-		return err
+		return withExitCode(ExitInput, err)
 	}
-	disc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	docs, filtered, err := filterDocs(docs, &runOpts.ApplyOpts)
 	if err != nil {
-		return err
+		return withExitCode(ExitInput, err)
 	}
-	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disc))
-	scheme := runtime.NewScheme()
-	if err := clientgoscheme.AddToScheme(scheme); err != nil {
-		return err
-	}
-	crClient, err := ctrlclient.New(cfg, ctrlclient.Options{Scheme: scheme})
+	printFiltered(rep, filtered)
+	rules, err := loadReadinessRules(&runOpts.ApplyOpts, docs)
 	if err != nil {
-		return err
+		return withExitCode(ExitInput, err)
 	}
 
-	// 2. Decode all manifest files or stdin
-	allDocs, err := readDocs(runOpts)
-	if err != nil {
-		return err
+	// 2.1 Validate against OpenAPI schemas before touching anything
+	if runOpts.ApplyOpts.Validate {
+		for _, c := range clusters {
+			printClusterHeader(clusters, c)
+			v, err := newValidator(runOpts, docs, c.disc)
+			if err != nil {
+				return withExitCode(ExitInput, c.wrap(err))
+			}
+			if _, err := validateDocs(c.rep, v, docs, false); err != nil {
+				return withExitCode(ExitInput, c.wrap(err))
+			}
+		}
 	}
 
-	// 3. Build an apply plan (detect existing objects & backup)
-	plan, err := prepareApplyPlan(allDocs, mapper, runOpts, dyn)
-	if err != nil {
+	// 2.2 Lock the release so concurrent runs cannot interleave; losing the
+	//     lock cancels ctx and fails the transaction
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if !runOpts.ApplyOpts.NoLock {
+		defer releaseLocks(clusters)
+		if err := acquireLocks(ctx, clusters, runOpts, cancel); err != nil {
+			return err
+		}
+	}
+
+	// 3. Build an apply plan per cluster (detect existing objects & backup)
+	for _, c := range clusters {
+		c.plan, err = prepareApplyPlan(c.rep, copyDocs(docs), c.mapper, runOpts, c.dyn)
+		if err != nil {
+			return withExitCode(ExitPlan, c.wrap(err))
+		}
+		if err := planDependants(ctx, c); err != nil {
+			return withExitCode(ExitPlan, c.wrap(err))
+		}
+		if runOpts.ApplyOpts.RestartWorkloads {
+			if err := planRestarts(ctx, c, time.Now()); err != nil {
+				return withExitCode(ExitPlan, c.wrap(err))
+			}
+		}
+		planUnchanged(ctx, c)
+		for i := range c.plan {
+			it := &c.plan[i]
+			ev := &Event{Type: EventPlan, Object: it.ref(), Source: it.src.String(), Action: it.action()}
+			if len(it.restart) > 0 {
+				ev.Message = "restart: uses changed " + strings.Join(it.restart, ", ")
+			}
+			c.rep.emit(ev)
+		}
+	}
+
+	// 3.1 Ask before touching a protected context
+	if err := confirmPlan(runOpts, clusters); err != nil {
 		return err
 	}
 
 	// 4. Apply objects (SSA Patch or Create) - on *any* error rollback
-	if err := applyPlanned(ctx, plan); err != nil {
-		return err
+	//    every cluster
+	wait := &waitOptions{
+		rules:        rules,
+		timeout:      runOpts.ApplyOpts.Timeout,
+		watch:        !runOpts.ApplyOpts.NoWatch,
+		pollInterval: runOpts.ApplyOpts.PollInterval,
+	}
+	if wait.pollInterval <= 0 {
+		wait.pollInterval = DefaultPollInterval
+	}
+	undo := &rollbackOptions{
+		timeout:         runOpts.ApplyOpts.RollbackTimeout,
+		propagation:     runOpts.ApplyOpts.DeletePropagation,
+		forceFinalizers: runOpts.ApplyOpts.ForceFinalizers,
+		wait:            wait,
+	}
+	if err := applyWithTimeout(ctx, clusters, &runOpts.ApplyOpts); err != nil {
+		printErrors(rep, err)
+		if runOpts.ApplyOpts.NoRollback {
+			return keepChanges(rep, clusters, runOpts, err)
+		}
+		if rbErr := rollback(rep, clusters, undo); rbErr != nil {
+			return withExitCode(ExitRollbackFailed, errors.Join(err, rbErr))
+		}
+		rolledBack = true
+		return withExitCode(ExitRolledBack, err)
 	}
 
-	// 5. Wait until every resource reaches the Current status, else rollback
-	//    (ctx carries the timeout specified by the user)
-	if err := waitStatus(ctx, plan, crClient, mapper); err != nil {
-		return rollbackAndExit(plan)
+	// 5. Wait until every resource reaches the Current status, else rollback.
+	//    Clusters are waited for one after another, they converge
+	//    concurrently anyway; deadlines count from the end of the apply.
+	wait.start = time.Now()
+	for _, c := range clusters {
+		printClusterHeader(clusters, c)
+		if err := waitStatus(ctx, c, wait); err != nil {
+			err = c.wrap(err)
+			printErrors(rep, err)
+			if runOpts.ApplyOpts.NoRollback {
+				return keepChanges(rep, clusters, runOpts, err)
+			}
+			if rbErr := rollback(rep, clusters, undo); rbErr != nil {
+				return withExitCode(ExitRollbackFailed, errors.Join(err, rbErr))
+			}
+			rolledBack = true
+			return withExitCode(ExitReadinessRolledBack, err)
+		}
 	}
 
-	fmt.Println("✓ Success")
+	printDrift(clusters)
+	rep.Println("✓ Success")
 	return nil
 }
 
 // applyPlanned executes the patch/create phase. For each item in the plan it
-// performs a server‑side apply (PATCH with ApplyPatchType). If *any* call
-// fails the function triggers a rollback *and* returns the error so the caller
-// can surface it.
-func applyPlanned(ctx context.Context, plan []applyItem) error {
+// performs a server‑side apply (PATCH with ApplyPatchType). It stops at the
+// first failing call and returns its error, rolling back is up to the caller.
+//
+// Right before mutating an object its live state is compared with the backup
+// (see checkDrift), and the patch carries the backed-up resourceVersion as a
+// precondition so a change in between is detected as a conflict.
+func applyPlanned(ctx context.Context, rep *reporter, plan []applyItem, driftPolicy string) error {
 	// contains only CRDs and Namespaces
-	var stageOne []applyItem
+	var stageOne []*applyItem
 
 	// contains all objects except for CRDs and Namespaces
-	var stageTwo []applyItem
+	var stageTwo []*applyItem
 
-	// prepare stages
-	for _, u := range plan {
-		if utils.IsClusterDefinition(u.obj) {
-			stageOne = append(stageOne, u)
+	// prepare stages, unchanged objects are left alone
+	for i := range plan {
+		if plan[i].unchanged {
+			continue
+		}
+		if utils.IsClusterDefinition(plan[i].obj) {
+			stageOne = append(stageOne, &plan[i])
 		} else {
-			stageTwo = append(stageTwo, u)
+			stageTwo = append(stageTwo, &plan[i])
 		}
 	}
 
 	// two stages for apply one by one
-	plans := [][]applyItem{
+	plans := [][]*applyItem{
 		stageOne, stageTwo,
 	}
 
 	for _, stagePlan := range plans {
 		for _, it := range stagePlan {
-			objJSON, err := json.Marshal(it.obj)
+			start := time.Now()
+			err := applyItemChecked(ctx, rep, it, driftPolicy)
+			rep.emit(&Event{
+				Type:       EventApplied,
+				Object:     it.ref(),
+				Source:     it.src.String(),
+				Action:     it.action(),
+				DurationMS: since(start),
+				Error:      errorString(err),
+			})
 			if err != nil {
-				// rollback not a stage-plan, but the full
-				return rollbackAndExit(plan)
+				return err
 			}
+			it.applied = true
+		}
+	}
 
-			// Server‑Side Apply: create or patch atomically on the apiserver.
-			_, err = it.dr.Patch(
-				ctx,
-				it.obj.GetName(),
-				types.ApplyPatchType,
-				objJSON,
-				metav1.PatchOptions{
-					FieldManager: "atomic-apply",
-					Force:        ptr.To(true), // overwrite conflicts
-				},
-			)
-			if err != nil {
-				// rollback not a stage-plan, but the full
-				return rollbackAndExit(plan)
+	return nil
+}
+
+// applyItemChecked applies a single item after checking it for drift. A
+// precondition conflict is drift as well; with DriftResnapshot the item is
+// re-snapshotted and applied again a limited number of times.
+func applyItemChecked(ctx context.Context, rep *reporter, it *applyItem, driftPolicy string) error {
+	const maxAttempts = 3
+
+	for attempt := 1; ; attempt++ {
+		if err := checkDrift(ctx, rep, it, driftPolicy); err != nil {
+			return err
+		}
+
+		obj := it.obj
+		if it.existed {
+			obj = it.obj.DeepCopy()
+			obj.SetResourceVersion(it.rv)
+		}
+		objJSON, err := json.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("apply %s: %w", it, err)
+		}
+
+		// Server‑Side Apply: create or patch atomically on the apiserver.
+		slog.Debug("server-side apply", "object", it.String(), "action", it.action(), "resourceVersion", it.rv, "attempt", attempt)
+		_, err = it.dr.Patch(
+			ctx,
+			it.obj.GetName(),
+			types.ApplyPatchType,
+			objJSON,
+			metav1.PatchOptions{
+				FieldManager: fieldManager,
+				Force:        ptr.To(true), // overwrite conflicts
+			},
+		)
+		if err != nil {
+			logAPIError("server-side apply failed", it, err)
+		}
+		if apierrors.IsConflict(err) && driftPolicy == DriftResnapshot && attempt < maxAttempts {
+			slog.Info("precondition conflict, re-snapshotting", "object", it.String(), "attempt", attempt)
+			continue
+		}
+		if apierrors.IsConflict(err) {
+			return fmt.Errorf("drift detected for %s: %w (see --on-drift)", it, err)
+		}
+		if err != nil {
+			return fmt.Errorf("apply %s: %w", it, err)
+		}
+		return nil
+	}
+}
+
+// logAPIError logs the details the apiserver gave for a failed request,
+// which are not part of the one-line error.
+func logAPIError(msg string, it *applyItem, err error) {
+	attrs := []any{"object", it.String(), "error", err}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		s := status.Status()
+		attrs = append(attrs, "code", s.Code, "reason", s.Reason)
+		if s.Details != nil {
+			for _, c := range s.Details.Causes {
+				attrs = append(attrs, "cause", fmt.Sprintf("%s: %s", c.Field, c.Message))
 			}
 		}
 	}
+	slog.Debug(msg, attrs...)
+}
 
-	return nil
+// printErrors prints every line of a (possibly joined) error as a failure.
+func printErrors(rep *reporter, err error) {
+	for _, line := range strings.Split(err.Error(), "\n") {
+		rep.Println("✗", line)
+	}
 }
 
-// prepareApplyPlan turns a slice of *unstructured.Unstructured into an ordered
-// slice of applyItems. For each resource it figures out:
+// prepareApplyPlan turns the decoded documents into an ordered slice of
+// applyItems. For each resource it figures out:
 //
 //   - the correct dynamic.ResourceInterface (namespaced or cluster‑scoped)
 //   - whether the object already exists (GET)
 //   - a JSON backup of the original object (for rollback)
+//   - the namespace, defaulted, enforced or rewritten (see namespacePolicy)
 //
 // The returned plan preserves the order of the input manifests - this allows
 // users to control apply order by structuring their kustomization/helm output
 // or file list.
+//
+// Objects are identified by group, kind, namespace and name after namespace
+// defaulting, so every object is planned (and backed up) exactly once.
+// Duplicates are resolved according to ApplyOpts.Duplicates and keep the
+// position of the first definition.
 func prepareApplyPlan(
-	allDocs []*unstructured.Unstructured,
+	rep *reporter,
+	allDocs []utils.Document,
 	mapper *restmapper.DeferredDiscoveryRESTMapper,
 	runOpts *AtomicApplyRunOptions,
-	dyn *dynamic.DynamicClient,
+	dyn dynamic.Interface,
 ) ([]applyItem, error) {
 	plan := make([]applyItem, 0, len(allDocs))
+	seen := make(map[object.ObjMetadata]int, len(allDocs))
+	nsPolicy := newNamespacePolicy(runOpts)
 
-	for _, u := range allDocs {
+	for _, d := range allDocs {
+		u := d.Object
 		gvk := u.GroupVersionKind()
 
 		// Resolve GVK -> GVR
 		m, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 		if err != nil {
+			slog.Debug("no mapping, refreshing discovery", "source", d.Source.String(), "gvk", gvk.String(), "error", err)
 			mapper.Reset()
 			m, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 			if err != nil {
-				return nil, fmt.Errorf("could not map GVK %v: %v", gvk, err)
+				return nil, sourceError(d.Source, fmt.Errorf("could not map GVK %v: %v", gvk, err))
 			}
 		}
 
+		// Default, enforce or rewrite the namespace
+		namespaced := m.Scope.Name() == meta.RESTScopeNameNamespace
+		slog.Debug("mapped", "source", d.Source.String(), "gvk", gvk.String(), "resource", m.Resource.String(), "namespaced", namespaced)
+		if err := nsPolicy.check(u, namespaced, d.Source); err != nil {
+			return nil, err
+		}
+
 		// Build a dynamic.ResourceInterface scoped to namespace if required
 		var dr dynamic.ResourceInterface
-		if m.Scope.Name() == meta.RESTScopeNameNamespace {
-			if u.GetNamespace() == "" {
-				ns := "default"
-				if runOpts.ConfigFlags.Namespace != nil && *runOpts.ConfigFlags.Namespace != "" {
-					ns = *runOpts.ConfigFlags.Namespace
-				}
-				u.SetNamespace(ns)
-			}
+		if namespaced {
 			dr = dyn.Resource(m.Resource).Namespace(u.GetNamespace())
 		} else {
 			dr = dyn.Resource(m.Resource)
 		}
 
-		it := applyItem{obj: u, dr: dr}
+		id := object.ObjMetadata{
+			GroupKind: gvk.GroupKind(),
+			Namespace: u.GetNamespace(),
+			Name:      u.GetName(),
+		}
+		if i, ok := seen[id]; ok {
+			if err := resolveDuplicate(rep, &plan[i], d, runOpts.ApplyOpts.Duplicates); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		seen[id] = len(plan)
+
+		it := applyItem{obj: u, dr: dr, src: d.Source}
 
 		// Detect current state to enable rollback
 		cur, err := dr.Get(context.TODO(), u.GetName(), metav1.GetOptions{})
-		if err == nil {
-			it.existed = true
-			it.rv = cur.GetResourceVersion()
-
-			// minimise diff size for backup:
-			// remove fields that should *not* be compared or preserved in the
-			// backup copy (status, managedFields, etc.). This keeps the backup small and
-			// avoids PATCH conflicts during rollback.
-			unstructured.RemoveNestedField(cur.Object, "metadata", "creationTimestamp")
-			unstructured.RemoveNestedField(cur.Object, "metadata", "generation")
-			unstructured.RemoveNestedField(cur.Object, "metadata", "resourceVersion")
-			unstructured.RemoveNestedField(cur.Object, "metadata", "uid")
-			unstructured.RemoveNestedField(cur.Object, "metadata", "managedFields")
-			unstructured.RemoveNestedField(cur.Object, "status")
-
-			it.backup, err = json.Marshal(cur.Object)
-			if err != nil {
-				return nil, err
+		switch {
+		case err == nil:
+			if err := it.snapshot(cur); err != nil {
+				return nil, sourceError(d.Source, err)
 			}
+		case apierrors.IsNotFound(err):
+		default:
+			// without the current state there is nothing to roll back to
+			return nil, sourceError(d.Source, fmt.Errorf("reading current state of %s: %w", it.String(), err))
 		}
+		slog.Debug("planned", "object", it.String(), "action", it.action(), "resourceVersion", it.rv)
 
 		plan = append(plan, it)
 	}
 
+	// references can only be rewritten once every moved namespace is known
+	for i := range plan {
+		if err := nsPolicy.rewriteRefs(plan[i].obj); err != nil {
+			return nil, sourceError(plan[i].src, err)
+		}
+	}
+
 	return plan, nil
 }
 
+// resolveDuplicate folds a second definition d of an already planned object
+// into it, or fails with both source locations.
+func resolveDuplicate(rep *reporter, it *applyItem, d utils.Document, mode string) error {
+	dup := fmt.Sprintf("%s/%s", d.Object.GetKind(), d.Object.GetName())
+	if ns := d.Object.GetNamespace(); ns != "" {
+		dup = fmt.Sprintf("%s/%s/%s", d.Object.GetKind(), ns, d.Object.GetName())
+	}
+
+	switch mode {
+	case DuplicatesLastWins:
+		rep.Printf("! duplicate %s: %s replaces %s\n", dup, d.Source, it.src)
+		it.obj = d.Object
+		it.src = d.Source
+		return nil
+	case DuplicatesMerge:
+		if err := utils.MergeObjects(it.obj.Object, d.Object.Object); err != nil {
+			return fmt.Errorf("duplicate %s: cannot merge %s into %s: %w", dup, d.Source, it.src, err)
+		}
+		rep.Printf("! duplicate %s: %s merged into %s\n", dup, d.Source, it.src)
+		return nil
+	default:
+		return fmt.Errorf("duplicate %s: defined in %s and %s", dup, it.src, d.Source)
+	}
+}
+
 // readDocs resolves -f arguments (or stdin '-') into a slice of decoded
 // Kubernetes objects. It expands directory globs, walks recursively if
 // requested and supports YAML documents containing multiple resources.
-func readDocs(runOpts *AtomicApplyRunOptions) ([]*unstructured.Unstructured, error) {
-	var allDocs []*unstructured.Unstructured
+// SOPS-encrypted files are decrypted in memory. Every object remembers the
+// file and document it was decoded from.
+func readDocs(ctx context.Context, runOpts *AtomicApplyRunOptions) ([]utils.Document, error) {
+	var allDocs []utils.Document
+	readOpts := &utils.ReadOptions{AgeKeyFile: runOpts.ApplyOpts.AgeKeyFile}
 
 	// 1. stdin mode: exactly one filename equal to "-"
 	if len(runOpts.ApplyOpts.Filenames) == 1 && runOpts.ApplyOpts.Filenames[0] == "-" {
@@ -329,7 +700,7 @@ func readDocs(runOpts *AtomicApplyRunOptions) ([]*unstructured.Unstructured, err
 		if err != nil {
 			return nil, fmt.Errorf("reading stdin: %w", err)
 		}
-		docs, err := utils.ReadObjects(bytes.NewReader(d))
+		docs, err := utils.ReadDocuments(bytes.NewReader(d), "(stdin)", readOpts)
 		if err != nil {
 			return nil, err
 		}
@@ -343,127 +714,301 @@ func readDocs(runOpts *AtomicApplyRunOptions) ([]*unstructured.Unstructured, err
 		return nil, err
 	}
 
+	remote, err := resolve.NewRemoteClient(&runOpts.ApplyOpts.Remote)
+	if err != nil {
+		return nil, err
+	}
+	if err := remote.BindToken(files); err != nil {
+		return nil, err
+	}
+
 	for _, file := range files {
-		fileContent, err := resolve.ReadFileContent(file)
+		fileContent, err := resolve.ReadFileContent(ctx, file, remote)
 		if err != nil {
 			return nil, err
 		}
-		docs, err := utils.ReadObjects(bytes.NewReader(fileContent))
+		docs, err := utils.ReadDocuments(bytes.NewReader(fileContent), file, readOpts)
 		if err != nil {
 			return nil, err
 		}
+		slog.Debug("read manifest", "file", file, "bytes", len(fileContent), "objects", len(docs))
 		allDocs = append(allDocs, docs...)
 	}
+	slog.Info("read manifests", "files", len(files), "objects", len(allDocs))
 
 	return allDocs, nil
 }
 
-// rollbackAndExit attempts to restore the cluster to the exact state observed
-// at the start of RunApply. It iterates over the plan *in the same order* and
-// either restores the backup JSON or deletes newly created objects.
+// sourceError prefixes err with the source of the offending document.
+func sourceError(src utils.Source, err error) error {
+	if s := src.String(); s != "" {
+		return fmt.Errorf("%s: %w", s, err)
+	}
+	return err
+}
+
+// rollback attempts to restore every cluster to the exact state observed at
+// the start of RunApply. It iterates over each plan *in the same order* and
+// either restores the backup JSON or deletes newly created objects; clusters
+// nothing was applied to are left alone. A cluster
+// that fails to roll back does not stop the others, their errors are returned
+// joined.
 //
-// If rollback succeeds the process terminates with os.Exit(1). If rollback
-// itself fails, the function returns the error so the caller can propagate it.
-func rollbackAndExit(plan []applyItem) error {
-	fmt.Println("⟲ rollback ...")
+// Rolling back gets its own context with timeout (0 for none): the context of
+// the run may already be canceled, which is often why it is rolled back.
+//
+// Once a cluster is rolled back the result is verified (see verifyRollback):
+// deleted objects must be gone and restored ones Current and equal to their
+// backup, within opts.wait.timeout. A divergence fails the rollback.
+func rollback(rep *reporter, clusters []*cluster, opts *rollbackOptions) error {
+	ctx, cancel := withOptionalTimeout(context.Background(), opts.timeout)
+	defer cancel()
 
-	for _, it := range plan {
-		if it.existed {
-			// Recreate the previous version from the JSON backup.
-			u := &unstructured.Unstructured{}
-			if err := u.UnmarshalJSON(it.backup); err != nil {
-				return err
-			}
-			if _, err := it.dr.Update(context.TODO(), u, metav1.UpdateOptions{}); err != nil {
-				return err
+	var errs []error
+	for _, c := range clusters {
+		if !c.touched() {
+			continue
+		}
+		printClusterHeader(clusters, c)
+		if err := rollbackPlan(ctx, c, opts.propagation); err != nil {
+			errs = append(errs, c.wrap(err))
+			continue
+		}
+		if err := verifyRollback(ctx, c, opts); err != nil {
+			errs = append(errs, c.wrap(fmt.Errorf("rollback verification failed: %w", err)))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	printDrift(clusters)
+	rep.Println("rollback complete")
+	return nil
+}
+
+// rollbackPlan restores the state of a single cluster. Objects that were not
+// applied are skipped: the apply stopped before them, or they failed or
+// drifted, so restoring their backup would overwrite a change made by someone
+// else. Created ones are deleted with the given propagation policy (one of
+// PropagationXXX).
+//
+// Deleting a Namespace or CRD deletes everything in it: one that holds
+// objects the run did not create is kept (see foreignContents). A restored
+// CRD gets its backed up custom resources back (see restoreDependants).
+func rollbackPlan(ctx context.Context, c *cluster, propagation string) error {
+	rep, plan := c.rep, c.plan
+	rep.Println("⟲ rollback ...")
+
+	for i := range plan {
+		it := &plan[i]
+		if !it.applied {
+			continue
+		}
+		start := time.Now()
+		if !it.existed && utils.IsClusterDefinition(it.obj) {
+			if kept := keepForeign(ctx, c, it); kept != "" {
+				rep.emit(&Event{
+					Type:    EventRollback,
+					Object:  it.ref(),
+					Source:  it.src.String(),
+					Action:  ActionKeep,
+					Message: kept,
+				})
+				rep.Printf("! kept %s: %s\n", it, kept)
+				continue
 			}
+		}
+		action, err := rollbackItem(ctx, it, propagation)
+		if action == ActionRestore && err == nil {
+			err = restoreDependants(ctx, rep, it)
+		}
+		if action == "" && err == nil {
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("rollback %s: %w", it, err)
+		}
+		rep.emit(&Event{
+			Type:       EventRollback,
+			Object:     it.ref(),
+			Source:     it.src.String(),
+			Action:     action,
+			DurationMS: since(start),
+			Error:      errorString(err),
+		})
+		if err != nil {
+			return err
+		}
+		it.undone = action
+		if action == ActionRestore {
+			rep.Println("⟲ restored", it)
 		} else {
-			if err := it.dr.Delete(context.TODO(), it.obj.GetName(), metav1.DeleteOptions{}); err != nil {
-				return err
-			}
+			rep.Println("⟲ deleted", it)
 		}
 	}
+	return nil
+}
 
-	// TODO: revive workloads (e.g. restart deployments) if needed
+// rollbackItem restores or deletes a single object and returns what was done,
+// an empty action means there was nothing to do.
+func rollbackItem(ctx context.Context, it *applyItem, propagation string) (string, error) {
+	slog.Debug("rolling back", "object", it.String(), "existed", it.existed)
+	if it.existed {
+		// Recreate the previous version from the JSON backup.
+		u := &unstructured.Unstructured{}
+		if err := u.UnmarshalJSON(it.backup); err != nil {
+			return ActionRestore, err
+		}
+		if _, err := it.dr.Update(ctx, u, metav1.UpdateOptions{}); err != nil {
+			return ActionRestore, err
+		}
+		return ActionRestore, nil
+	}
 
-	fmt.Println("rollback complete")
-	os.Exit(1) // terminate so caller does not continue after fatal failure
-	return nil // unreachable but required by compiler
+	err := it.dr.Delete(ctx, it.obj.GetName(), metav1.DeleteOptions{PropagationPolicy: propagationPolicy(propagation)})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	return ActionDelete, err
 }
 
 // waitStatus polls every resource in the plan until they all reach the desired
 // kstatus.CurrentStatus (READY/AVAILABLE). It builds on cli‑utils status
 // poller so behaviour matches kubectl‑apply‑describe.
 //
+// Objects annotated with katomik.io/wait: "false" are not waited for, every
+// other object has to become Current within its deadline: opts.start plus
+// --timeout or its katomik.io/timeout annotation.
+//
 // The function cancels its internal poller when either:
 //
-//	a) every resource is Current, or
-//	b) the outer context (with timeout) expires.
-func waitStatus(
-	ctx context.Context,
-	plan []applyItem,
-	reader ctrlclient.Reader,
-	mapper meta.RESTMapper,
-) error {
+//	a) every resource is Current,
+//	b) a resource is Failed,
+//	c) a resource missed its deadline, or
+//	d) the outer context is canceled (e.g. the lock was lost).
+func waitStatus(ctx context.Context, c *cluster, opts *waitOptions) error {
+	rep, plan := c.rep, c.plan
 	cancelCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	// 1. Convert applyItems -> ObjMetadata list
 	resources := make([]object.ObjMetadata, 0, len(plan))
-	for _, it := range plan {
+	items := make(map[object.ObjMetadata]*applyItem, len(plan))
+	objs := make([]*unstructured.Unstructured, 0, len(plan))
+	timeouts := newDeadlines()
+	waitFor := make(map[object.ObjMetadata]time.Duration, len(plan))
+	for i := range plan {
+		it := &plan[i]
+		if it.unchanged {
+			continue
+		}
+		wait, timeout, err := readiness.Wait(it.obj, opts.timeout)
+		if err != nil {
+			return sourceError(it.src, err)
+		}
+		if !wait {
+			rep.Printf("- not waiting for %s (%s: false)\n", it, readiness.AnnotationWait)
+			continue
+		}
 		id, err := object.RuntimeToObjMeta(it.obj)
 		if err != nil {
-			return err
+			return sourceError(it.src, err)
 		}
+		objs = append(objs, it.obj)
 		resources = append(resources, id)
+		items[id] = it
+		waitFor[id] = timeout
+		timeouts.set(id, opts.start.Add(timeout))
 	}
 
 	if len(resources) == 0 {
-		fmt.Println("✓ no trackable resources")
+		rep.Println("✓ no trackable resources")
 		return nil
 	}
 
 	// print waiting resources
-	calcLen := printer.CalcLen(resources)
-	t := table.New(os.Stdout)
+	t := table.New(rep)
 	t.SetRowLines(false)
-	t.SetHeaders("RESOURCE", "NAMESPACE")
+	t.SetHeaders("RESOURCE", "NAMESPACE", "SOURCE")
 	for _, id := range resources {
 		ns := id.Namespace
 		if ns == "" {
 			ns = "(cluster)"
 		}
 		kn := fmt.Sprintf("%s/%s", id.GroupKind.Kind, id.Name)
-		t.AddRow(kn, ns)
+		t.AddRow(kn, ns, items[id].src.String())
 	}
 	t.Render()
 
-	fmt.Println("+ watching")
-
-	// 2. Start status poller
-	poller := polling.NewStatusPoller(reader, mapper, polling.Options{})
-	eventCh := poller.Poll(cancelCtx, resources, polling.PollOptions{PollInterval: 2 * time.Second})
+	rep.Printf("+ waiting for %d resource(s) to become Current\n", len(resources))
+	slog.Info("waiting for readiness", "resources", len(resources), "watch", opts.watch)
+	prog := newProgress(rep, resources)
 
-	// 3. Listen & aggregate
-	statusCollector := collector.NewResourceStatusCollector(resources)
-	done := statusCollector.ListenWithObserver(eventCh, statusObserver(cancel, kstatus.CurrentStatus, calcLen))
-	<-done
+	// 2. Listen & aggregate; every second the deadlines are checked and a
+	//    live view updates its elapsed times
+	stopTicker := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopTicker:
+				return
+			case now := <-ticker.C:
+				prog.tick()
+				if len(timeouts.expired(now)) > 0 {
+					cancel()
+				}
+			}
+		}
+	}()
 
-	fmt.Println("+ watching")
+	// 3. Watch (or poll) the status; objects with readiness rules are
+	//    evaluated by a custom reader. A forbidden watch falls back to polling.
+	custom := readiness.NewStatusReader(c.mapper, opts.rules, objs)
+	observer := statusObserver(rep, items, prog, timeouts, cancel, kstatus.CurrentStatus)
+	statusCollector := collectStatus(cancelCtx, c, resources, custom, opts, observer)
+	close(stopTicker)
+	prog.finish()
 
 	// 4. "Global" error emitted by collector
 	if statusCollector.Error != nil {
 		return statusCollector.Error
 	}
 
-	// 5. Outer context deadline reached?
-	if ctx.Err() != nil {
+	// 5. A resource failed (see readiness rules), no need to wait any longer
+	var failed []error
+	for _, id := range resources {
+		rs := statusCollector.ResourceStatuses[id]
+		if rs != nil && rs.Status == kstatus.FailedStatus {
+			failed = append(failed, sourceError(items[id].src,
+				fmt.Errorf("resource failed: %s/%s: %s", id.GroupKind.Kind, id.Name, rs.Message)))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Join(failed...)
+	}
+
+	// 6. Deadlines missed or outer context canceled? Report every resource
+	//    that missed its deadline, or every one not ready yet if canceled.
+	late := make(map[object.ObjMetadata]bool)
+	for _, id := range timeouts.expired(time.Now()) {
+		late[id] = true
+	}
+	if len(late) > 0 || ctx.Err() != nil {
 		var errs []error
 		for _, id := range resources {
 			rs := statusCollector.ResourceStatuses[id]
-			if rs != nil && rs.Status != kstatus.CurrentStatus {
-				errs = append(errs, fmt.Errorf("resource not ready: %s (%s)", id.String(), rs.Status))
+			status := kstatus.UnknownStatus
+			if rs != nil {
+				status = rs.Status
+			}
+			if status == kstatus.CurrentStatus || (!late[id] && ctx.Err() == nil) {
+				continue
 			}
+			errs = append(errs, sourceError(items[id].src,
+				fmt.Errorf("resource not ready within %s: %s/%s (%s)", waitFor[id], id.GroupKind.Kind, id.Name, status)))
 		}
 		errs = append(errs, ctx.Err())
 		return errors.Join(errs...)
@@ -472,15 +1017,41 @@ func waitStatus(
 	return nil
 }
 
-// statusObserver prints a single line with the *first* non‑ready resource and
-// cancels the poller when the aggregate state matches the desired one.
-func statusObserver(cancel context.CancelFunc, desired kstatus.Status, calcLen *printer.Len) collector.ObserverFunc {
-	printed := make(map[object.ObjMetadata]struct{})
+// statusObserver feeds every status update into the progress view and
+// cancels the poller when the aggregate state matches the desired one. Every
+// status change of a resource is emitted as a status event.
+func statusObserver(
+	rep *reporter,
+	items map[object.ObjMetadata]*applyItem,
+	prog *progress,
+	timeouts *deadlines,
+	cancel context.CancelFunc,
+	desired kstatus.Status,
+) collector.ObserverFunc {
+	last := make(map[object.ObjMetadata]kstatus.Status)
+	start := time.Now()
 
-	return func(c *collector.ResourceStatusCollector, _ pollEvent.Event) {
-		var rss []*pollEvent.ResourceStatus
-		var nonReady []*pollEvent.ResourceStatus
+	return func(c *collector.ResourceStatusCollector, e pollEvent.Event) {
+		if e.Type == pollEvent.ResourceUpdateEvent && e.Resource != nil {
+			id := e.Resource.Identifier
+			slog.Debug("status", "object", fmt.Sprintf("%s/%s", id.GroupKind.Kind, id.Name), "namespace", id.Namespace,
+				"status", e.Resource.Status, "message", e.Resource.Message)
+			prog.update(e.Resource)
+			timeouts.observe(id, e.Resource.Status)
+			if it, ok := items[id]; ok && last[id] != e.Resource.Status {
+				last[id] = e.Resource.Status
+				rep.emit(&Event{
+					Type:       EventStatus,
+					Object:     it.ref(),
+					Source:     it.src.String(),
+					Status:     e.Resource.Status.String(),
+					Message:    e.Resource.Message,
+					DurationMS: since(start),
+				})
+			}
+		}
 
+		var rss []*pollEvent.ResourceStatus
 		for _, rs := range c.ResourceStatuses {
 			if rs == nil {
 				continue
@@ -489,41 +1060,19 @@ func statusObserver(cancel context.CancelFunc, desired kstatus.Status, calcLen *
 				continue
 			}
 			rss = append(rss, rs)
-			if rs.Status != desired {
-				nonReady = append(nonReady, rs)
+		}
+
+		// A failed resource fails the whole wait
+		for _, rs := range rss {
+			if rs.Status == kstatus.FailedStatus {
+				cancel()
+				return
 			}
 		}
 
 		// Aggregate over all resources
 		if aggregator.AggregateStatus(rss, desired) == desired {
 			cancel()
-			return
-		}
-
-		// Log first non‑ready object (friendly UX)
-		if len(nonReady) > 0 {
-			sort.Slice(nonReady, func(i, j int) bool {
-				return nonReady[i].Identifier.Name < nonReady[j].Identifier.Name
-			})
-			first := nonReady[0]
-
-			// wait message
-			id := first.Identifier
-			if _, ok := printed[id]; !ok {
-				ns := id.Namespace
-				if ns == "" {
-					ns = "(cluster)"
-				}
-				kn := fmt.Sprintf("%s/%s", id.GroupKind.Kind, id.Name)
-				fmt.Printf("| %-*s %-*s %s\n",
-					calcLen.KindNameMaxLen,
-					kn,
-					calcLen.NamespaceMaxLen,
-					ns,
-					first.Status,
-				)
-				printed[id] = struct{}{}
-			}
 		}
 	}
 }
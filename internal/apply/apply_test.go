@@ -0,0 +1,40 @@
+package apply
+
+import (
+	"testing"
+
+	"github.com/hashmap-kz/katomik/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestPrepareApplyPlan(t *testing.T) {
+	c, dyn, _ := statusTestCluster(t)
+	dyn.PrependReactor("get", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.(clienttesting.GetAction).GetName() == "forbidden" {
+			return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "forbidden", nil)
+		}
+		return false, nil, nil
+	})
+	doc := func(name string) utils.Document {
+		u := testConfigMap("v2")
+		u.SetName(name)
+		return utils.Document{Object: u, Source: utils.Source{File: name + ".yaml"}}
+	}
+
+	plan, err := prepareApplyPlan(c.rep, []utils.Document{doc("cm"), doc("new")}, c.mapper, &AtomicApplyRunOptions{}, c.dyn)
+	require.NoError(t, err)
+	require.Len(t, plan, 2)
+	assert.Equal(t, ActionUpdate, plan[0].action())
+	assert.Equal(t, ActionCreate, plan[1].action())
+
+	// an object that cannot be read is not planned as a create
+	_, err = prepareApplyPlan(c.rep, []utils.Document{doc("cm"), doc("forbidden")}, c.mapper, &AtomicApplyRunOptions{}, c.dyn)
+	require.Error(t, err)
+	assert.True(t, apierrors.IsForbidden(err))
+	assert.Contains(t, err.Error(), "forbidden.yaml")
+}
@@ -0,0 +1,292 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/hashmap-kz/katomik/internal/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+// dependants are the custom resources of a CRD the run updates. A new
+// schema or dropped versions can make the API server prune or lose them, so
+// they are backed up when planning and restored with the CRD on rollback.
+type dependants struct {
+	res  dynamic.NamespaceableResourceInterface
+	objs []*unstructured.Unstructured
+}
+
+// planDependants backs up the custom resources of every existing CRD in the
+// plan of c. Objects the plan applies itself are left out, they have their
+// own backup.
+func planDependants(ctx context.Context, c *cluster) error {
+	planned, err := plannedIDs(c.plan)
+	if err != nil {
+		return err
+	}
+	for i := range c.plan {
+		it := &c.plan[i]
+		if !utils.IsCRD(it.obj) || !it.existed {
+			continue
+		}
+		backup := &unstructured.Unstructured{}
+		if err := backup.UnmarshalJSON(it.backup); err != nil {
+			return sourceError(it.src, err)
+		}
+		gvr, ok := crdResource(backup)
+		if !ok {
+			continue
+		}
+		res := c.dyn.Resource(gvr)
+		list, err := res.List(ctx, metav1.ListOptions{})
+		if err != nil {
+			c.rep.Printf("! cannot back up the custom resources of %s: %v\n", it, err)
+			slog.Warn("cannot list custom resources", "object", it.String(), "resource", gvr.String(), "error", err)
+			continue
+		}
+
+		deps := &dependants{res: res}
+		for j := range list.Items {
+			cr := &list.Items[j]
+			id, err := object.RuntimeToObjMeta(cr)
+			if err != nil || planned.Has(id) {
+				continue
+			}
+			snap := applyItem{}
+			if err := snap.snapshot(cr); err != nil {
+				return sourceError(it.src, err)
+			}
+			u := &unstructured.Unstructured{}
+			if err := u.UnmarshalJSON(snap.backup); err != nil {
+				return sourceError(it.src, err)
+			}
+			deps.objs = append(deps.objs, u)
+		}
+		if len(deps.objs) > 0 {
+			it.deps = deps
+			c.rep.Printf("+ backed up %d custom resource(s) of %s\n", len(deps.objs), it)
+			slog.Debug("backed up dependants", "object", it.String(), "count", len(deps.objs))
+		}
+	}
+	return nil
+}
+
+// crdResource returns the resource of the storage version of a CRD.
+func crdResource(crd *unstructured.Unstructured) (schema.GroupVersionResource, bool) {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, v := range versions {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if storage, _ := m["storage"].(bool); storage {
+			name, _ := m["name"].(string)
+			return schema.GroupVersionResource{Group: group, Version: name, Resource: plural}, group != "" && plural != ""
+		}
+	}
+	return schema.GroupVersionResource{}, false
+}
+
+// restoreDependants recreates the backed up custom resources of a restored
+// CRD that are gone and updates the ones that diverged from their backup.
+func restoreDependants(ctx context.Context, rep *reporter, it *applyItem) error {
+	if it.deps == nil {
+		return nil
+	}
+	for _, u := range it.deps.objs {
+		dr := dynamic.ResourceInterface(it.deps.res)
+		if ns := u.GetNamespace(); ns != "" {
+			dr = it.deps.res.Namespace(ns)
+		}
+		kn := fmt.Sprintf("%s/%s", u.GetKind(), u.GetName())
+
+		live, err := dr.Get(ctx, u.GetName(), metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			if _, err := dr.Create(ctx, u, metav1.CreateOptions{}); err != nil {
+				return fmt.Errorf("restore %s of %s: %w", kn, it, err)
+			}
+			rep.Println("⟲ recreated", kn)
+		case err != nil:
+			return fmt.Errorf("restore %s of %s: %w", kn, it, err)
+		case len(divergence(u.Object, live.Object)) > 0:
+			if _, err := dr.Update(ctx, u, metav1.UpdateOptions{}); err != nil {
+				return fmt.Errorf("restore %s of %s: %w", kn, it, err)
+			}
+			rep.Println("⟲ restored", kn)
+		}
+	}
+	return nil
+}
+
+// foreignContents returns the objects ("Kind/name", sorted) deleting the
+// Namespace or CRD of it would delete along with it although the plan did
+// not create them, e.g. because someone else added them during the run.
+//
+// Objects owned by others are left out (their owner counts), as are those
+// every namespace gets (the default ServiceAccount, kube-root-ca.crt), the
+// ones maintained by the cluster (Events, Endpoints) and the claims of
+// planned StatefulSets.
+func foreignContents(ctx context.Context, c *cluster, it *applyItem) ([]string, error) {
+	planned, err := plannedIDs(c.plan)
+	if err != nil {
+		return nil, err
+	}
+
+	var lists []*unstructured.UnstructuredList
+	var claims []string
+	switch {
+	case utils.IsNamespace(it.obj):
+		claims = claimPrefixes(c.plan, it.obj.GetName())
+		resources, err := discovery.ServerPreferredNamespacedResources(c.disc)
+		if err != nil && len(resources) == 0 {
+			return nil, err
+		}
+		if err != nil {
+			slog.Debug("partial discovery", "error", err)
+		}
+		for _, rl := range resources {
+			gv, err := schema.ParseGroupVersion(rl.GroupVersion)
+			if err != nil {
+				continue
+			}
+			for _, r := range rl.APIResources {
+				if strings.Contains(r.Name, "/") || !sets.New(r.Verbs...).Has("list") || clusterMaintained.Has(r.Kind) {
+					continue
+				}
+				list, err := c.dyn.Resource(gv.WithResource(r.Name)).Namespace(it.obj.GetName()).List(ctx, metav1.ListOptions{})
+				if err != nil {
+					return nil, fmt.Errorf("list %s in %s: %w", r.Name, it.obj.GetName(), err)
+				}
+				lists = append(lists, list)
+			}
+		}
+	case utils.IsCRD(it.obj):
+		gvr, ok := crdResource(it.obj)
+		if !ok {
+			return nil, nil
+		}
+		list, err := c.dyn.Resource(gvr).List(ctx, metav1.ListOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", gvr.Resource, err)
+		}
+		lists = append(lists, list)
+	default:
+		return nil, nil
+	}
+
+	var foreign []string
+	for _, list := range lists {
+		for i := range list.Items {
+			u := &list.Items[i]
+			id, err := object.RuntimeToObjMeta(u)
+			if err != nil || planned.Has(id) || len(u.GetOwnerReferences()) > 0 || namespaceDefault(u) {
+				continue
+			}
+			if u.GetKind() == "PersistentVolumeClaim" && hasAnyPrefix(u.GetName(), claims) {
+				continue
+			}
+			foreign = append(foreign, fmt.Sprintf("%s/%s", u.GetKind(), u.GetName()))
+		}
+	}
+	sort.Strings(foreign)
+	return foreign, nil
+}
+
+// keepForeign tells why the created Namespace or CRD of it must not be
+// deleted on rollback, empty if it can be.
+func keepForeign(ctx context.Context, c *cluster, it *applyItem) string {
+	foreign, err := foreignContents(ctx, c, it)
+	if err != nil {
+		slog.Warn("cannot list contents", "object", it.String(), "error", err)
+		return fmt.Sprintf("cannot tell what deleting it would delete: %v", err)
+	}
+	if len(foreign) == 0 {
+		return ""
+	}
+	const show = 5
+	names := foreign
+	if len(names) > show {
+		names = append(names[:show:show], fmt.Sprintf("and %d more", len(foreign)-show))
+	}
+	return fmt.Sprintf("deleting it would delete %d object(s) not created by this run: %s",
+		len(foreign), strings.Join(names, ", "))
+}
+
+// clusterMaintained are kinds the cluster creates in namespaces by itself.
+var clusterMaintained = sets.New("Event", "Endpoints", "EndpointSlice")
+
+// namespaceDefault reports whether u is created in every namespace.
+func namespaceDefault(u *unstructured.Unstructured) bool {
+	switch {
+	case u.GetKind() == "ServiceAccount" && u.GetName() == "default":
+		return true
+	case u.GetKind() == "ConfigMap" && u.GetName() == "kube-root-ca.crt":
+		return true
+	case u.GetKind() == "Secret":
+		t, _, _ := unstructured.NestedString(u.Object, "type")
+		return t == "kubernetes.io/service-account-token"
+	}
+	return false
+}
+
+// claimPrefixes returns the name prefixes ("<template>-<statefulset>-") of
+// the PersistentVolumeClaims the StatefulSets of plan create in namespace
+// ns. The claims have no owner, yet the run created them.
+func claimPrefixes(plan []applyItem, ns string) []string {
+	var prefixes []string
+	for i := range plan {
+		sts := plan[i].obj
+		if sts.GetKind() != "StatefulSet" || sts.GetNamespace() != ns {
+			continue
+		}
+		templates, _, _ := unstructured.NestedSlice(sts.Object, "spec", "volumeClaimTemplates")
+		for _, t := range templates {
+			m, ok := t.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(m, "metadata", "name")
+			prefixes = append(prefixes, name+"-"+sts.GetName()+"-")
+		}
+	}
+	return prefixes
+}
+
+// hasAnyPrefix reports whether s starts with one of prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// plannedIDs returns the identifiers of every object in plan.
+func plannedIDs(plan []applyItem) (sets.Set[object.ObjMetadata], error) {
+	ids := sets.New[object.ObjMetadata]()
+	for i := range plan {
+		id, err := object.RuntimeToObjMeta(plan[i].obj)
+		if err != nil {
+			return nil, sourceError(plan[i].src, err)
+		}
+		ids.Insert(id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,155 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+var widgetGVR = schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+
+func testObject(apiVersion, kind, ns, name string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(apiVersion)
+	u.SetKind(kind)
+	u.SetNamespace(ns)
+	u.SetName(name)
+	return u
+}
+
+func testCRD() *unstructured.Unstructured {
+	crd := testObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "widgets.example.com")
+	crd.Object["spec"] = map[string]interface{}{
+		"group": "example.com",
+		"names": map[string]interface{}{"plural": "widgets", "kind": "Widget"},
+		"versions": []interface{}{
+			map[string]interface{}{"name": "v1beta1", "storage": false},
+			map[string]interface{}{"name": "v1", "storage": true},
+		},
+	}
+	return crd
+}
+
+func testWidget(name, size string) *unstructured.Unstructured {
+	u := testObject("example.com/v1", "Widget", "default", name)
+	u.Object["spec"] = map[string]interface{}{"size": size}
+	return u
+}
+
+func cascadeCluster(t *testing.T, objs ...runtime.Object) (*cluster, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		widgetGVR:                                           "WidgetList",
+		{Version: "v1", Resource: "configmaps"}:             "ConfigMapList",
+		{Version: "v1", Resource: "serviceaccounts"}:        "ServiceAccountList",
+		{Version: "v1", Resource: "persistentvolumeclaims"}: "PersistentVolumeClaimList",
+		{Version: "v1", Resource: "pods"}:                   "PodList",
+		{Version: "v1", Resource: "events"}:                 "EventList",
+	}, objs...)
+	disc := kubefake.NewClientset().Discovery().(*fakediscovery.FakeDiscovery)
+	disc.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+			{Name: "serviceaccounts", Kind: "ServiceAccount", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+			{Name: "persistentvolumeclaims", Kind: "PersistentVolumeClaim", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+			{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+			{Name: "pods/log", Kind: "Pod", Namespaced: true, Verbs: metav1.Verbs{"get"}},
+			{Name: "events", Kind: "Event", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+		},
+	}}
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	return &cluster{dyn: dyn, disc: disc, rep: newReporter(streams, "")}, dyn
+}
+
+func TestCRDResource(t *testing.T) {
+	gvr, ok := crdResource(testCRD())
+	require.True(t, ok)
+	assert.Equal(t, widgetGVR, gvr)
+
+	_, ok = crdResource(testObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "broken"))
+	assert.False(t, ok)
+}
+
+func TestDependants_BackupAndRestore(t *testing.T) {
+	c, dyn := cascadeCluster(t, testWidget("gone", "s"), testWidget("changed", "m"), testWidget("planned", "l"))
+
+	crd := applyItem{obj: testCRD()}
+	require.NoError(t, crd.snapshot(testCRD()))
+	c.plan = []applyItem{crd, {obj: testWidget("planned", "xl")}}
+	require.NoError(t, planDependants(context.Background(), c))
+
+	it := &c.plan[0]
+	require.NotNil(t, it.deps)
+	var names []string
+	for _, u := range it.deps.objs {
+		names = append(names, u.GetName())
+		assert.Empty(t, u.GetResourceVersion())
+	}
+	assert.ElementsMatch(t, []string{"gone", "changed"}, names, "planned objects have their own backup")
+
+	widgets := dyn.Resource(widgetGVR).Namespace("default")
+	require.NoError(t, widgets.Delete(context.Background(), "gone", metav1.DeleteOptions{}))
+	_, err := widgets.Update(context.Background(), testWidget("changed", "pruned"), metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, restoreDependants(context.Background(), c.rep, it))
+	for name, size := range map[string]string{"gone": "s", "changed": "m"} {
+		u, err := widgets.Get(context.Background(), name, metav1.GetOptions{})
+		require.NoError(t, err)
+		got, _, _ := unstructured.NestedString(u.Object, "spec", "size")
+		assert.Equal(t, size, got, name)
+	}
+}
+
+func TestForeignContents_Namespace(t *testing.T) {
+	owned := testObject("v1", "ConfigMap", "new", "app-1234")
+	owned.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "app-12", UID: "1"}})
+	c, _ := cascadeCluster(t,
+		testObject("v1", "ConfigMap", "new", "app"),
+		testObject("v1", "ConfigMap", "new", "kube-root-ca.crt"),
+		testObject("v1", "ServiceAccount", "new", "default"),
+		testObject("v1", "PersistentVolumeClaim", "new", "data-db-0"),
+		testObject("v1", "Event", "new", "app.123"),
+		owned,
+		testObject("v1", "ConfigMap", "new", "intruder"),
+		testObject("v1", "PersistentVolumeClaim", "new", "scratch"),
+		testObject("v1", "ConfigMap", "other", "elsewhere"),
+	)
+	sts := testObject("apps/v1", "StatefulSet", "new", "db")
+	sts.Object["spec"] = map[string]interface{}{"volumeClaimTemplates": []interface{}{
+		map[string]interface{}{"metadata": map[string]interface{}{"name": "data"}},
+	}}
+	c.plan = []applyItem{
+		{obj: testObject("v1", "Namespace", "", "new")},
+		{obj: testObject("v1", "ConfigMap", "new", "app")},
+		{obj: sts},
+	}
+
+	foreign, err := foreignContents(context.Background(), c, &c.plan[0])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ConfigMap/intruder", "PersistentVolumeClaim/scratch"}, foreign)
+
+	kept := keepForeign(context.Background(), c, &c.plan[0])
+	assert.Equal(t, "deleting it would delete 2 object(s) not created by this run: ConfigMap/intruder, PersistentVolumeClaim/scratch", kept)
+}
+
+func TestForeignContents_CRD(t *testing.T) {
+	c, _ := cascadeCluster(t, testWidget("planned", "s"))
+	c.plan = []applyItem{{obj: testCRD()}, {obj: testWidget("planned", "s")}}
+
+	foreign, err := foreignContents(context.Background(), c, &c.plan[0])
+	require.NoError(t, err)
+	assert.Empty(t, foreign)
+	assert.Empty(t, keepForeign(context.Background(), c, &c.plan[0]))
+}
@@ -0,0 +1,213 @@
+package apply
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/hashmap-kz/katomik/internal/lock"
+	"github.com/hashmap-kz/katomik/internal/utils"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/restmapper"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// cluster bundles the clients of one target cluster together with the plan
+// built for it. A run has one cluster per entry of ApplyOpts.Contexts, or a
+// single unnamed cluster for the current context.
+//
+//	name   - kube context, empty for the current context
+//	dyn    - dynamic client used to apply and roll back
+//	disc   - discovery client (REST mapping, OpenAPI schemas)
+//	mapper - GVK -> GVR mapper backed by disc
+//	reader - controller-runtime client used by the status poller
+//	kube   - typed client (Leases)
+//	lock   - Lease held while the transaction runs, nil if not locked
+//	plan   - apply plan of this cluster
+//	rep    - reporter tagging events with the cluster name
+type cluster struct {
+	name   string
+	dyn    dynamic.Interface
+	disc   discovery.DiscoveryInterface
+	mapper *restmapper.DeferredDiscoveryRESTMapper
+	reader ctrlclient.Reader
+	kube   kubernetes.Interface
+	lock   *lock.Lock
+	plan   []applyItem
+	rep    *reporter
+}
+
+func (c *cluster) String() string {
+	if c.name == "" {
+		return "current context"
+	}
+	return fmt.Sprintf("context %q", c.name)
+}
+
+// wrap prefixes err with the cluster name when the run targets named contexts.
+func (c *cluster) wrap(err error) error {
+	if err == nil || c.name == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", c, err)
+}
+
+// newClusters builds the clients of every target cluster.
+func newClusters(runOpts *AtomicApplyRunOptions, rep *reporter) ([]*cluster, error) {
+	if len(runOpts.ApplyOpts.Contexts) == 0 {
+		c, err := newCluster("", runOpts.ConfigFlags)
+		if err != nil {
+			return nil, err
+		}
+		c.rep = rep
+		return []*cluster{c}, nil
+	}
+
+	clusters := make([]*cluster, 0, len(runOpts.ApplyOpts.Contexts))
+	seen := make(map[string]struct{}, len(runOpts.ApplyOpts.Contexts))
+	for _, name := range runOpts.ApplyOpts.Contexts {
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("context %q is listed more than once", name)
+		}
+		seen[name] = struct{}{}
+
+		c, err := newCluster(name, contextConfigFlags(runOpts.ConfigFlags, name))
+		if err != nil {
+			return nil, fmt.Errorf("context %q: %w", name, err)
+		}
+		c.rep = rep.forCluster(name)
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
+
+func newCluster(name string, flags *genericclioptions.ConfigFlags) (*cluster, error) {
+	cfg, err := flags.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("connecting", "context", name, "host", cfg.Host)
+
+	// Tune client QPS/Burst
+	cfg.QPS = 50
+	cfg.Burst = 100
+
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	disc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	crClient, err := ctrlclient.New(cfg, ctrlclient.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cluster{
+		name:   name,
+		dyn:    dyn,
+		disc:   disc,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disc)),
+		reader: crClient,
+		kube:   kube,
+	}, nil
+}
+
+// contextConfigFlags returns connection flags for the named context. The
+// kubeconfig, namespace and impersonation settings are taken over from base;
+// cluster, user and server overrides are not, they belong to a single cluster.
+func contextConfigFlags(base *genericclioptions.ConfigFlags, name string) *genericclioptions.ConfigFlags {
+	f := genericclioptions.NewConfigFlags(true)
+	f.KubeConfig = base.KubeConfig
+	f.CacheDir = base.CacheDir
+	f.Namespace = base.Namespace
+	f.Impersonate = base.Impersonate
+	f.ImpersonateUID = base.ImpersonateUID
+	f.ImpersonateGroup = base.ImpersonateGroup
+	f.Timeout = base.Timeout
+	f.Context = &name
+	return f
+}
+
+// touched reports whether anything was applied to c, only then there is
+// something to roll back.
+func (c *cluster) touched() bool {
+	for i := range c.plan {
+		if c.plan[i].applied {
+			return true
+		}
+	}
+	return false
+}
+
+// printClusterHeader starts the output section of c when the run spans more
+// than one cluster, so the output stays grouped per cluster.
+func printClusterHeader(clusters []*cluster, c *cluster) {
+	if len(clusters) > 1 {
+		c.rep.Printf("=== %s\n", c)
+	}
+}
+
+// copyDocs returns deep copies of docs, planning mutates the objects
+// (namespaces, merged duplicates) and every cluster needs its own set.
+func copyDocs(docs []utils.Document) []utils.Document {
+	copied := make([]utils.Document, 0, len(docs))
+	for _, d := range docs {
+		copied = append(copied, utils.Document{Object: d.Object.DeepCopy(), Source: d.Source})
+	}
+	return copied
+}
+
+// applyClusters applies the plan of every cluster, one cluster after another
+// or all of them concurrently. One after another, the first failing cluster
+// stops the run and the remaining clusters are not touched; concurrently,
+// every cluster is applied. The returned error joins the failures.
+func applyClusters(ctx context.Context, clusters []*cluster, opts *AtomicApplyOptions) error {
+	errs := make([]error, len(clusters))
+
+	if !opts.ParallelClusters {
+		for i, c := range clusters {
+			if errs[i] = c.wrap(applyPlanned(ctx, c.rep, c.plan, opts.DriftPolicy)); errs[i] != nil {
+				// no need to touch the remaining clusters, everything is rolled back
+				break
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.wrap(applyPlanned(ctx, c.rep, c.plan, opts.DriftPolicy))
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// applyWithTimeout runs applyClusters bounded by opts.ApplyTimeout.
+func applyWithTimeout(ctx context.Context, clusters []*cluster, opts *AtomicApplyOptions) error {
+	ctx, cancel := withOptionalTimeout(ctx, opts.ApplyTimeout)
+	defer cancel()
+	return applyClusters(ctx, clusters, opts)
+}
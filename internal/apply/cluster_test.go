@@ -0,0 +1,34 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestApplyClusters_SequentialStopsAtFailure(t *testing.T) {
+	failing := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	failing.PrependReactor("patch", "configmaps", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewBadRequest("invalid")
+	})
+	first := &cluster{name: "eu", rep: testReporter(), plan: []applyItem{
+		{obj: testConfigMap("v1"), dr: failing.Resource(configMapGVR).Namespace("default")},
+	}}
+	second, dyn := plannedItem(t)
+	dyn.ClearActions()
+	untouched := &cluster{name: "us", rep: testReporter(), plan: []applyItem{*second}}
+	clusters := []*cluster{first, untouched}
+
+	err := applyClusters(context.Background(), clusters, &AtomicApplyOptions{DriftPolicy: DriftAbort})
+	require.Error(t, err)
+	assert.False(t, untouched.touched())
+
+	require.NoError(t, rollback(testReporter(), clusters, &rollbackOptions{wait: testWaitOptions()}))
+	assert.Empty(t, dyn.Actions(), "a cluster nothing was applied to is not rolled back")
+}
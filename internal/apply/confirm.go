@@ -0,0 +1,159 @@
+package apply
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// confirmAnswer has to be typed to confirm a run.
+const confirmAnswer = "yes"
+
+// planSummary counts what the plan of a cluster does and lists the objects
+// that deserve a second look before confirming.
+//
+//	create, update - objects created and updated
+//	unchanged      - objects applying would not change (see planUnchanged)
+//	restart        - workloads restarted (see planRestarts)
+//	clusterScoped  - cluster-scoped objects ("Kind/name")
+//	system         - objects in kube-system ("Kind/name")
+type planSummary struct {
+	create, update int
+	unchanged      int
+	restart        int
+	clusterScoped  []string
+	system         []string
+}
+
+func summarizePlan(plan []applyItem) *planSummary {
+	s := &planSummary{}
+	for i := range plan {
+		it := &plan[i]
+		switch {
+		case it.unchanged:
+			s.unchanged++
+		case it.existed:
+			s.update++
+		default:
+			s.create++
+		}
+		if len(it.restart) > 0 {
+			s.restart++
+		}
+		kn := fmt.Sprintf("%s/%s", it.obj.GetKind(), it.obj.GetName())
+		switch it.obj.GetNamespace() {
+		case "":
+			s.clusterScoped = append(s.clusterScoped, kn)
+		case "kube-system":
+			s.system = append(s.system, kn)
+		}
+	}
+	return s
+}
+
+func (s *planSummary) print(w io.Writer, target string) {
+	counts := fmt.Sprintf("%d to create, %d to update", s.create, s.update)
+	if s.restart > 0 {
+		counts += fmt.Sprintf(" (%d restart(s))", s.restart)
+	}
+	counts += fmt.Sprintf(", %d unchanged", s.unchanged)
+	_, _ = fmt.Fprintf(w, "Plan for %s: %s\n", target, counts)
+	if len(s.clusterScoped) > 0 {
+		_, _ = fmt.Fprintf(w, "  ! cluster-scoped: %s\n", strings.Join(s.clusterScoped, ", "))
+	}
+	if len(s.system) > 0 {
+		_, _ = fmt.Fprintf(w, "  ! in kube-system: %s\n", strings.Join(s.system, ", "))
+	}
+}
+
+// contextName returns the kube context of c, resolving the current context
+// of the kubeconfig for the cluster of a single-context run.
+func contextName(runOpts *AtomicApplyRunOptions, c *cluster) string {
+	if c.name != "" {
+		return c.name
+	}
+	if runOpts.ConfigFlags == nil {
+		return ""
+	}
+	if runOpts.ConfigFlags.Context != nil && *runOpts.ConfigFlags.Context != "" {
+		return *runOpts.ConfigFlags.Context
+	}
+	raw, err := runOpts.ConfigFlags.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return ""
+	}
+	return raw.CurrentContext
+}
+
+// protectedBy returns the first pattern of ProtectedContexts (path.Match
+// syntax) matching context name, empty if none does.
+func protectedBy(patterns []string, name string) string {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return p
+		}
+	}
+	return ""
+}
+
+// confirmPlan asks for typed confirmation of the plans before anything is
+// applied: always with Confirm, or when a target context is protected (see
+// ProtectedContexts). Yes skips the question.
+//
+// The summary and the question go to ErrOut, whatever the output format, the
+// answer is read from In. A run reading its manifests from stdin cannot be
+// confirmed (ExitInput), an answer other than confirmAnswer fails with
+// ExitDeclined.
+func confirmPlan(runOpts *AtomicApplyRunOptions, clusters []*cluster) error {
+	opts := &runOpts.ApplyOpts
+	if opts.Yes {
+		return nil
+	}
+	var reasons []string
+	for _, c := range clusters {
+		name := contextName(runOpts, c)
+		if p := protectedBy(opts.ProtectedContexts, name); p != "" {
+			reasons = append(reasons, fmt.Sprintf("context %q is protected (%s)", name, p))
+		}
+	}
+	if !opts.Confirm && len(reasons) == 0 {
+		return nil
+	}
+	if len(opts.Filenames) == 1 && opts.Filenames[0] == "-" {
+		why := "--confirm"
+		if len(reasons) > 0 {
+			why = strings.Join(reasons, ", ")
+		}
+		return InputError("confirmation required (%s) but the manifests are read from stdin, pass --yes", why)
+	}
+
+	w := runOpts.Streams.ErrOut
+	if w == nil {
+		w = io.Discard
+	}
+	for _, c := range clusters {
+		summarizePlan(c.plan).print(w, fmt.Sprintf("context %q", contextName(runOpts, c)))
+	}
+	for _, r := range reasons {
+		_, _ = fmt.Fprintf(w, "! %s\n", r)
+	}
+	_, _ = fmt.Fprintf(w, "Type %q to apply: ", confirmAnswer)
+
+	if runOpts.Streams.In == nil {
+		return withExitCode(ExitDeclined, errors.New("not confirmed: no input"))
+	}
+	answer, err := bufio.NewReader(runOpts.Streams.In).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return withExitCode(ExitDeclined, fmt.Errorf("not confirmed: %w", err))
+	}
+	if !strings.HasSuffix(answer, "\n") {
+		_, _ = fmt.Fprintln(w)
+	}
+	if strings.TrimSpace(answer) != confirmAnswer {
+		return withExitCode(ExitDeclined, errors.New("not confirmed, nothing was applied"))
+	}
+	return nil
+}
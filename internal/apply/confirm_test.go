@@ -0,0 +1,63 @@
+package apply
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+func TestSummarizePlan(t *testing.T) {
+	restarted := applyItem{obj: testObject("apps/v1", "Deployment", "default", "web"), existed: true, restart: []string{"ConfigMap/cfg"}}
+	s := summarizePlan([]applyItem{
+		{obj: testObject("v1", "Namespace", "", "team-a")},
+		{obj: testObject("v1", "ConfigMap", "default", "cfg"), existed: true},
+		{obj: testObject("v1", "ConfigMap", "kube-system", "coredns"), existed: true},
+		restarted,
+	})
+	assert.Equal(t, 1, s.create)
+	assert.Equal(t, 3, s.update)
+	assert.Equal(t, 1, s.restart)
+	assert.Equal(t, []string{"Namespace/team-a"}, s.clusterScoped)
+	assert.Equal(t, []string{"ConfigMap/coredns"}, s.system)
+}
+
+func TestProtectedBy(t *testing.T) {
+	patterns := []string{"staging", "prod-*"}
+	assert.Equal(t, "prod-*", protectedBy(patterns, "prod-eu"))
+	assert.Equal(t, "staging", protectedBy(patterns, "staging"))
+	assert.Empty(t, protectedBy(patterns, "dev"))
+	assert.Empty(t, protectedBy(nil, "prod-eu"))
+}
+
+func confirmRun(t *testing.T, answer string, opts AtomicApplyOptions) (string, error) {
+	t.Helper()
+	streams, in, _, errOut := genericiooptions.NewTestIOStreams()
+	in.WriteString(answer)
+	c := &cluster{name: "prod-eu", plan: []applyItem{{obj: testObject("v1", "ConfigMap", "default", "cfg")}}}
+	opts.ProtectedContexts = []string{"prod-*"}
+	err := confirmPlan(&AtomicApplyRunOptions{Streams: streams, ApplyOpts: opts}, []*cluster{c})
+	return errOut.String(), err
+}
+
+func TestConfirmPlan(t *testing.T) {
+	out, err := confirmRun(t, "yes\n", AtomicApplyOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, out, `Plan for context "prod-eu": 1 to create, 0 to update`)
+	assert.Contains(t, out, `! context "prod-eu" is protected (prod-*)`)
+	assert.True(t, strings.HasSuffix(out, `Type "yes" to apply: `))
+
+	_, err = confirmRun(t, "y\n", AtomicApplyOptions{})
+	assert.Equal(t, ExitDeclined, ExitCode(err))
+	_, err = confirmRun(t, "", AtomicApplyOptions{})
+	assert.Equal(t, ExitDeclined, ExitCode(err), "no answer declines")
+
+	out, err = confirmRun(t, "", AtomicApplyOptions{Yes: true})
+	require.NoError(t, err)
+	assert.Empty(t, out)
+
+	_, err = confirmRun(t, "yes\n", AtomicApplyOptions{Filenames: []string{"-"}})
+	assert.Equal(t, ExitInput, ExitCode(err), "stdin holds the manifests")
+}
@@ -0,0 +1,76 @@
+package apply
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashmap-kz/katomik/internal/readiness"
+	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+// deadlines tracks the readiness deadline of every watched resource
+// (--timeout or its katomik.io/timeout annotation). It is fed by the status
+// observer and checked periodically while waiting.
+type deadlines struct {
+	mu     sync.Mutex
+	at     map[object.ObjMetadata]time.Time
+	status map[object.ObjMetadata]kstatus.Status
+}
+
+func newDeadlines() *deadlines {
+	return &deadlines{
+		at:     make(map[object.ObjMetadata]time.Time),
+		status: make(map[object.ObjMetadata]kstatus.Status),
+	}
+}
+
+func (d *deadlines) set(id object.ObjMetadata, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.at[id] = at
+}
+
+func (d *deadlines) observe(id object.ObjMetadata, status kstatus.Status) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status[id] = status
+}
+
+// expired returns the resources that are not Current at now although their
+// deadline has passed, in no particular order.
+func (d *deadlines) expired(now time.Time) []object.ObjMetadata {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var ids []object.ObjMetadata
+	for id, at := range d.at {
+		if now.After(at) && d.status[id] != kstatus.CurrentStatus {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// waitOptions configure waitStatus.
+//
+//	rules        - readiness rules of the run
+//	timeout      - readiness deadline of objects without katomik.io/timeout
+//	start        - time the deadlines count from
+//	watch        - watch the objects instead of polling them
+//	pollInterval - how often objects are polled without watch
+type waitOptions struct {
+	rules        *readiness.Rules
+	timeout      time.Duration
+	start        time.Time
+	watch        bool
+	pollInterval time.Duration
+}
+
+// withOptionalTimeout is context.WithTimeout, a timeout of 0 means none.
+func withOptionalTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
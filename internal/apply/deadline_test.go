@@ -0,0 +1,30 @@
+package apply
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+func TestDeadlines(t *testing.T) {
+	start := time.Now()
+	fast := object.ObjMetadata{GroupKind: schema.GroupKind{Kind: "ConfigMap"}, Namespace: "default", Name: "cm"}
+	slow := object.ObjMetadata{GroupKind: schema.GroupKind{Group: "apps", Kind: "StatefulSet"}, Namespace: "default", Name: "db"}
+
+	d := newDeadlines()
+	d.set(fast, start.Add(time.Minute))
+	d.set(slow, start.Add(10*time.Minute))
+
+	assert.Empty(t, d.expired(start))
+	assert.Equal(t, []object.ObjMetadata{fast}, d.expired(start.Add(2*time.Minute)))
+
+	// Current resources never expire
+	d.observe(fast, kstatus.CurrentStatus)
+	d.observe(slow, kstatus.InProgressStatus)
+	assert.Empty(t, d.expired(start.Add(2*time.Minute)))
+	assert.Equal(t, []object.ObjMetadata{slow}, d.expired(start.Add(11*time.Minute)))
+}
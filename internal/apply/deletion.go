@@ -0,0 +1,138 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Deletion propagation policies for objects deleted on rollback, see
+// metav1.DeletionPropagation.
+//
+//	PropagationForeground - dependents are deleted first, the object waits
+//	PropagationBackground - the object is deleted right away, its dependents
+//	                        by the garbage collector (default)
+//	PropagationOrphan     - dependents are kept
+const (
+	PropagationForeground = "foreground"
+	PropagationBackground = "background"
+	PropagationOrphan     = "orphan"
+)
+
+// propagationPolicy maps a PropagationXXX value to the API's, nil for the
+// default of the resource.
+func propagationPolicy(s string) *metav1.DeletionPropagation {
+	var p metav1.DeletionPropagation
+	switch s {
+	case PropagationForeground:
+		p = metav1.DeletePropagationForeground
+	case PropagationBackground:
+		p = metav1.DeletePropagationBackground
+	case PropagationOrphan:
+		p = metav1.DeletePropagationOrphan
+	default:
+		return nil
+	}
+	return &p
+}
+
+// rollbackOptions configure rollback.
+//
+//	timeout         - time for rolling back and verifying, 0 for none
+//	propagation     - propagation policy of deletes, one of PropagationXXX
+//	forceFinalizers - clear the finalizers of deleted objects still
+//	                  terminating once the wait is over
+//	wait            - how the result is waited for (see verifyRollback)
+type rollbackOptions struct {
+	timeout         time.Duration
+	propagation     string
+	forceFinalizers bool
+	wait            *waitOptions
+}
+
+// stuckDeletion looks at an object deleted on rollback that is still there
+// after waiting. A terminating object is held by its finalizers: with
+// forceFinalizers they are cleared and the object is waited for to go away,
+// otherwise the error names them. nil means the object is gone.
+//
+// A Namespace is also held by the finalizers in its spec (e.g. "kubernetes",
+// removed once its content is gone); those can only be cleared through the
+// finalize subresource.
+func stuckDeletion(ctx context.Context, rep *reporter, it *applyItem, opts *rollbackOptions) error {
+	kn := fmt.Sprintf("%s/%s", it.obj.GetKind(), it.obj.GetName())
+	live, err := it.dr.Get(ctx, it.obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", it, err)
+	}
+	finalizers := live.GetFinalizers()
+	specFinalizers := namespaceFinalizers(live)
+	all := append(append([]string{}, finalizers...), specFinalizers...)
+	if live.GetDeletionTimestamp() == nil || len(all) == 0 {
+		return fmt.Errorf("deleted object still present: %s", kn)
+	}
+	if !opts.forceFinalizers {
+		return fmt.Errorf("deleted object still terminating: %s, waiting for finalizers %s (see --force-finalizers)",
+			kn, strings.Join(all, ", "))
+	}
+
+	rep.Printf("! clearing finalizers of %s: %s\n", it, strings.Join(all, ", "))
+	slog.Warn("clearing finalizers", "object", it.String(), "finalizers", all)
+	if len(finalizers) > 0 {
+		patch := []byte(`{"metadata":{"finalizers":null}}`)
+		patched, err := it.dr.Patch(ctx, it.obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("clear finalizers of %s: %w", it, err)
+		}
+		if patched != nil {
+			live = patched
+		}
+	}
+	if len(specFinalizers) > 0 {
+		unstructured.RemoveNestedField(live.Object, "spec", "finalizers")
+		_, err := it.dr.Update(ctx, live, metav1.UpdateOptions{}, "finalize")
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("clear spec finalizers of %s: %w", it, err)
+		}
+	}
+
+	ctx, cancel := withOptionalTimeout(ctx, opts.wait.timeout)
+	defer cancel()
+	err = wait.PollUntilContextCancel(ctx, opts.wait.pollInterval, true, func(ctx context.Context) (bool, error) {
+		_, err := it.dr.Get(ctx, it.obj.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("deleted object still present after clearing its finalizers: %s: %w", kn, err)
+	}
+	return nil
+}
+
+// namespaceFinalizers returns the spec.finalizers of a core Namespace, nil for
+// any other object.
+func namespaceFinalizers(u *unstructured.Unstructured) []string {
+	if u.GetAPIVersion() != "v1" || u.GetKind() != "Namespace" {
+		return nil
+	}
+	finalizers, _, _ := unstructured.NestedStringSlice(u.Object, "spec", "finalizers")
+	return finalizers
+}
@@ -0,0 +1,86 @@
+package apply
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestPropagationPolicy(t *testing.T) {
+	assert.Equal(t, metav1.DeletePropagationForeground, *propagationPolicy(PropagationForeground))
+	assert.Equal(t, metav1.DeletePropagationBackground, *propagationPolicy(PropagationBackground))
+	assert.Equal(t, metav1.DeletePropagationOrphan, *propagationPolicy(PropagationOrphan))
+	assert.Nil(t, propagationPolicy(""))
+}
+
+// terminatingItem returns an item for the ConfigMap "cm", which is being
+// deleted but held by a finalizer.
+func terminatingItem(t *testing.T) (*applyItem, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	cm := testConfigMap("v1")
+	cm.SetFinalizers([]string{"example.com/cleanup"})
+	cm.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), cm)
+	return &applyItem{obj: testConfigMap("v1"), dr: dyn.Resource(configMapGVR).Namespace("default")}, dyn
+}
+
+func TestStuckDeletion_ReportsFinalizers(t *testing.T) {
+	it, _ := terminatingItem(t)
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+
+	err := stuckDeletion(context.Background(), newReporter(streams, ""), it, &rollbackOptions{wait: testWaitOptions()})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "deleted object still terminating: ConfigMap/cm, waiting for finalizers example.com/cleanup")
+}
+
+func TestStuckDeletion_ForceFinalizers(t *testing.T) {
+	it, dyn := terminatingItem(t)
+	// like the apiserver, remove the object once its finalizers are cleared
+	dyn.PrependReactor("patch", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		assert.JSONEq(t, `{"metadata":{"finalizers":null}}`, string(action.(clienttesting.PatchAction).GetPatch()))
+		return true, nil, dyn.Tracker().Delete(configMapGVR, "default", "cm")
+	})
+	streams, _, out, _ := genericiooptions.NewTestIOStreams()
+
+	opts := &rollbackOptions{forceFinalizers: true, wait: testWaitOptions()}
+	require.NoError(t, stuckDeletion(context.Background(), newReporter(streams, ""), it, opts))
+	assert.Contains(t, out.String(), "! clearing finalizers of ConfigMap/cm: example.com/cleanup")
+}
+
+func TestStuckDeletion_NamespaceSpecFinalizers(t *testing.T) {
+	nsGVR := schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	ns := testObject("v1", "Namespace", "", "team-a")
+	ns.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+	require.NoError(t, unstructured.SetNestedStringSlice(ns.Object, []string{"kubernetes"}, "spec", "finalizers"))
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), ns)
+	it := &applyItem{obj: testObject("v1", "Namespace", "", "team-a"), dr: dyn.Resource(nsGVR)}
+	streams, _, out, _ := genericiooptions.NewTestIOStreams()
+
+	err := stuckDeletion(context.Background(), newReporter(streams, ""), it, &rollbackOptions{wait: testWaitOptions()})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "deleted object still terminating: Namespace/team-a, waiting for finalizers kubernetes")
+
+	// like the apiserver, remove the Namespace once the finalize subresource
+	// cleared its spec finalizers
+	dyn.PrependReactor("update", "namespaces", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		update := action.(clienttesting.UpdateAction)
+		assert.Equal(t, "finalize", update.GetSubresource())
+		u := update.GetObject().(*unstructured.Unstructured)
+		_, found, _ := unstructured.NestedStringSlice(u.Object, "spec", "finalizers")
+		assert.False(t, found)
+		return true, nil, dyn.Tracker().Delete(nsGVR, "", "team-a")
+	})
+	opts := &rollbackOptions{forceFinalizers: true, wait: testWaitOptions()}
+	require.NoError(t, stuckDeletion(context.Background(), newReporter(streams, ""), it, opts))
+	assert.Contains(t, out.String(), "! clearing finalizers of Namespace/team-a: kubernetes")
+}
@@ -0,0 +1,111 @@
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// What to do when an object changed between planning and applying.
+//
+//	DriftAbort      - fail the transaction and roll back (default)
+//	DriftResnapshot - take a new backup of the live object and go on
+const (
+	DriftAbort      = "abort"
+	DriftResnapshot = "resnapshot"
+)
+
+// snapshot records the live object cur (nil if it does not exist) as the
+// state to restore on rollback.
+func (it *applyItem) snapshot(cur *unstructured.Unstructured) error {
+	if cur == nil {
+		it.existed = false
+		it.rv = ""
+		it.backup = nil
+		it.managed = nil
+		return nil
+	}
+
+	it.existed = true
+	it.rv = cur.GetResourceVersion()
+	it.managed = managedFields(cur)
+
+	cur = cur.DeepCopy()
+	// minimise diff size for backup:
+	// remove fields that should *not* be compared or preserved in the
+	// backup copy (status, managedFields, etc.). This keeps the backup small and
+	// avoids PATCH conflicts during rollback.
+	unstructured.RemoveNestedField(cur.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(cur.Object, "metadata", "generation")
+	unstructured.RemoveNestedField(cur.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(cur.Object, "metadata", "uid")
+	unstructured.RemoveNestedField(cur.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(cur.Object, "status")
+
+	backup, err := json.Marshal(cur.Object)
+	if err != nil {
+		return err
+	}
+	it.backup = backup
+	return nil
+}
+
+// checkDrift compares the live object with the snapshot taken by
+// prepareApplyPlan. On drift the item is either re-snapshotted (and the drift
+// recorded in it.drift) or an error is returned, depending on policy.
+func checkDrift(ctx context.Context, rep *reporter, it *applyItem, policy string) error {
+	cur, err := it.dr.Get(ctx, it.obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cur, err = nil, nil
+	}
+	if err != nil {
+		return fmt.Errorf("drift check %s: %w", it, err)
+	}
+
+	var drift string
+	switch {
+	case it.existed && cur == nil:
+		drift = "deleted since planning"
+	case !it.existed && cur != nil:
+		drift = "created since planning"
+	case it.existed && cur.GetResourceVersion() != it.rv:
+		drift = fmt.Sprintf("resourceVersion changed from %s to %s since planning", it.rv, cur.GetResourceVersion())
+	default:
+		return nil
+	}
+
+	if policy != DriftResnapshot {
+		return fmt.Errorf("drift detected for %s: %s (see --on-drift)", it, drift)
+	}
+	if err := it.snapshot(cur); err != nil {
+		return fmt.Errorf("drift check %s: %w", it, err)
+	}
+	if it.drift != "" {
+		drift = it.drift + "; " + drift
+	}
+	it.drift = drift
+	rep.Printf("! drift %s: %s, backup re-taken\n", it, drift)
+	rep.emit(&Event{Type: EventDrift, Object: it.ref(), Source: it.src.String(), Message: drift})
+	return nil
+}
+
+// printDrift lists every object that changed between planning and applying.
+func printDrift(clusters []*cluster) {
+	for _, c := range clusters {
+		for i := range c.plan {
+			it := &c.plan[i]
+			if it.drift == "" {
+				continue
+			}
+			if c.name != "" {
+				c.rep.Printf("! drift %s in %s: %s\n", it, c, it.drift)
+			} else {
+				c.rep.Printf("! drift %s: %s\n", it, it.drift)
+			}
+		}
+	}
+}
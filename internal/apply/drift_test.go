@@ -0,0 +1,100 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var configMapGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+func testConfigMap(data string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("ConfigMap")
+	u.SetNamespace("default")
+	u.SetName("cm")
+	_ = unstructured.SetNestedField(u.Object, data, "data", "key")
+	return u
+}
+
+func plannedItem(t *testing.T) (*applyItem, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	live := testConfigMap("v1")
+	live.SetResourceVersion("1")
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), live)
+
+	it := &applyItem{obj: testConfigMap("v2"), dr: dyn.Resource(configMapGVR).Namespace("default")}
+	cur, err := it.dr.Get(context.Background(), "cm", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NoError(t, it.snapshot(cur))
+	return it, dyn
+}
+
+func modify(t *testing.T, it *applyItem) {
+	t.Helper()
+	changed := testConfigMap("changed")
+	changed.SetResourceVersion("2")
+	_, err := it.dr.Update(context.Background(), changed, metav1.UpdateOptions{})
+	require.NoError(t, err)
+}
+
+func TestCheckDrift_None(t *testing.T) {
+	it, _ := plannedItem(t)
+	require.NoError(t, checkDrift(context.Background(), testReporter(), it, DriftAbort))
+	assert.Empty(t, it.drift)
+}
+
+func TestCheckDrift_Abort(t *testing.T) {
+	it, _ := plannedItem(t)
+	modify(t, it)
+
+	err := checkDrift(context.Background(), testReporter(), it, DriftAbort)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "drift detected for ConfigMap/cm: resourceVersion changed from 1 to 2")
+}
+
+func TestCheckDrift_Resnapshot(t *testing.T) {
+	it, _ := plannedItem(t)
+	modify(t, it)
+
+	require.NoError(t, checkDrift(context.Background(), testReporter(), it, DriftResnapshot))
+	assert.Equal(t, "2", it.rv)
+	assert.Contains(t, string(it.backup), "changed")
+	assert.Contains(t, it.drift, "resourceVersion changed from 1 to 2")
+
+	// deleted in the meantime: nothing to restore anymore
+	require.NoError(t, it.dr.Delete(context.Background(), "cm", metav1.DeleteOptions{}))
+	require.NoError(t, checkDrift(context.Background(), testReporter(), it, DriftResnapshot))
+	assert.False(t, it.existed)
+	assert.Contains(t, it.drift, "deleted since planning")
+}
+
+func testReporter() *reporter {
+	return newReporter(genericiooptions.NewTestIOStreamsDiscard(), "")
+}
+
+func TestRollbackPlan_KeepsDriftedObject(t *testing.T) {
+	it, _ := plannedItem(t)
+	modify(t, it)
+	c := &cluster{rep: testReporter(), plan: []applyItem{*it}}
+
+	err := applyPlanned(context.Background(), c.rep, c.plan, DriftAbort)
+	require.Error(t, err)
+	require.False(t, c.plan[0].applied)
+
+	require.NoError(t, rollbackPlan(context.Background(), c, ""))
+	assert.Empty(t, c.plan[0].undone)
+	live, err := it.dr.Get(context.Background(), "cm", metav1.GetOptions{})
+	require.NoError(t, err)
+	got, _, _ := unstructured.NestedString(live.Object, "data", "key")
+	assert.Equal(t, "changed", got, "the change of the other writer is kept")
+}
@@ -0,0 +1,78 @@
+package apply
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes of katomik. Every error returned by RunApply, RunValidate and
+// RunRollback carries one of them (see ExitCode), the process exits with it.
+//
+//	ExitOK                  - success
+//	ExitFailure             - any failure not classified below
+//	ExitInput               - invalid flags, kubeconfig or manifests (decoding, filters,
+//	                          schema validation); no cluster was changed
+//	ExitPlan                - planning failed (discovery, mapping, namespace policy,
+//	                          duplicates); no cluster was changed
+//	ExitRolledBack          - applying failed, every change was rolled back
+//	ExitReadinessRolledBack - resources did not become ready in time, every change
+//	                          was rolled back
+//	ExitRollbackFailed      - rolling back failed or did not verify, clusters may
+//	                          be inconsistent
+//	ExitLocked              - the lock is held by another run or cannot be taken;
+//	                          no cluster was changed
+//	ExitNotRolledBack       - applying or waiting failed and the changes were kept
+//	                          (NoRollback), the rollback plan was saved
+//	ExitDeclined            - the plan was not confirmed; nothing was changed
+const (
+	ExitOK                  = 0
+	ExitFailure             = 1
+	ExitInput               = 2
+	ExitPlan                = 3
+	ExitRolledBack          = 4
+	ExitReadinessRolledBack = 5
+	ExitRollbackFailed      = 6
+	ExitLocked              = 7
+	ExitNotRolledBack       = 8
+	ExitDeclined            = 9
+)
+
+// ExitError is an error with the exit code the process should terminate with.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// withExitCode attaches code to err, a nil err stays nil.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ExitError{Code: code, Err: err}
+}
+
+// InputError marks err as an input error (ExitInput).
+func InputError(format string, args ...any) error {
+	return withExitCode(ExitInput, fmt.Errorf(format, args...))
+}
+
+// ExitCode returns the exit code for err: ExitOK for nil, the code of the
+// outermost ExitError in its chain, else ExitFailure.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return ExitFailure
+}
@@ -0,0 +1,50 @@
+package apply
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, ExitOK, ExitCode(nil))
+	assert.Equal(t, ExitFailure, ExitCode(errors.New("boom")))
+	assert.Equal(t, ExitInput, ExitCode(InputError("bad flag %q", "x")))
+	assert.Nil(t, withExitCode(ExitPlan, nil))
+
+	// the code survives wrapping and joining
+	err := withExitCode(ExitRolledBack, errors.New("apply failed"))
+	assert.Equal(t, ExitRolledBack, ExitCode(fmt.Errorf("context %q: %w", "eu", err)))
+	assert.Equal(t, ExitRolledBack, ExitCode(errors.Join(err, errors.New("other"))))
+
+	// the outermost code wins
+	outer := withExitCode(ExitRollbackFailed, errors.Join(err, errors.New("rollback failed")))
+	assert.Equal(t, ExitRollbackFailed, ExitCode(outer))
+	assert.Equal(t, "apply failed\nrollback failed", outer.Error())
+}
+
+func TestRunValidate_ConnectionExitCode(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "cm.yaml")
+	require.NoError(t, os.WriteFile(manifest, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n"), 0o600))
+
+	flags := genericclioptions.NewConfigFlags(false)
+	kubeconfig := filepath.Join(t.TempDir(), "missing")
+	flags.KubeConfig = &kubeconfig
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+
+	err := RunValidate(context.Background(), &AtomicApplyRunOptions{
+		ConfigFlags: flags,
+		Streams:     streams,
+		ApplyOpts:   AtomicApplyOptions{Filenames: []string{manifest}},
+	})
+	require.Error(t, err)
+	assert.Equal(t, ExitInput, ExitCode(err))
+}
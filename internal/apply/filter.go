@@ -0,0 +1,96 @@
+package apply
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aquasecurity/table"
+	"github.com/hashmap-kz/katomik/internal/utils"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// filteredDoc is a document excluded by the manifest filters along with the
+// filter that excluded it.
+type filteredDoc struct {
+	doc    utils.Document
+	reason string
+}
+
+// filterDocs applies the label selector and kind filters of opts to docs and
+// returns the documents to keep and the ones filtered out, both in input order.
+//
+// Kinds are matched case-insensitively either by kind ("Deployment") or by
+// kind and group ("Deployment.apps"). --exclude-kinds wins over --only-kinds.
+func filterDocs(docs []utils.Document, opts *AtomicApplyOptions) ([]utils.Document, []filteredDoc, error) {
+	selector := labels.Everything()
+	if opts.Selector != "" {
+		var err error
+		selector, err = labels.Parse(opts.Selector)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid selector %q: %w", opts.Selector, err)
+		}
+	}
+	if selector.Empty() && len(opts.OnlyKinds) == 0 && len(opts.ExcludeKinds) == 0 {
+		return docs, nil, nil
+	}
+
+	kept := make([]utils.Document, 0, len(docs))
+	var filtered []filteredDoc
+	for _, d := range docs {
+		gk := d.Object.GroupVersionKind().GroupKind()
+		switch {
+		case matchKinds(gk, opts.ExcludeKinds):
+			filtered = append(filtered, filteredDoc{doc: d, reason: "--exclude-kinds"})
+		case len(opts.OnlyKinds) > 0 && !matchKinds(gk, opts.OnlyKinds):
+			filtered = append(filtered, filteredDoc{doc: d, reason: "--only-kinds"})
+		case !selector.Matches(labels.Set(d.Object.GetLabels())):
+			filtered = append(filtered, filteredDoc{doc: d, reason: "--selector"})
+		default:
+			kept = append(kept, d)
+		}
+	}
+	return kept, filtered, nil
+}
+
+// matchKinds reports whether gk is listed in kinds.
+func matchKinds(gk schema.GroupKind, kinds []string) bool {
+	for _, k := range kinds {
+		kind, group, hasGroup := strings.Cut(k, ".")
+		if !strings.EqualFold(kind, gk.Kind) {
+			continue
+		}
+		if !hasGroup || strings.EqualFold(group, gk.Group) {
+			return true
+		}
+	}
+	return false
+}
+
+// printFiltered lists the objects excluded by the manifest filters.
+func printFiltered(rep *reporter, filtered []filteredDoc) {
+	if len(filtered) == 0 {
+		return
+	}
+	for _, f := range filtered {
+		rep.emit(&Event{
+			Type:    EventFiltered,
+			Object:  docRef(f.doc),
+			Source:  f.doc.Source.String(),
+			Message: f.reason,
+		})
+	}
+	rep.Printf("- filtered out %d object(s)\n", len(filtered))
+	t := table.New(rep)
+	t.SetRowLines(false)
+	t.SetHeaders("RESOURCE", "NAMESPACE", "SOURCE", "FILTER")
+	for _, f := range filtered {
+		ns := f.doc.Object.GetNamespace()
+		if ns == "" {
+			ns = "-"
+		}
+		kn := fmt.Sprintf("%s/%s", f.doc.Object.GetKind(), f.doc.Object.GetName())
+		t.AddRow(kn, ns, f.doc.Source.String(), f.reason)
+	}
+	t.Render()
+}
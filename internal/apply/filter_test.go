@@ -0,0 +1,91 @@
+package apply
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashmap-kz/katomik/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const filterManifests = `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: databases.example.com
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  labels:
+    tier: frontend
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+  labels:
+    tier: backend
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  labels:
+    tier: frontend
+`
+
+func filterNames(t *testing.T, opts *AtomicApplyOptions) (kept, filtered []string) {
+	t.Helper()
+	docs, err := utils.ReadDocuments(strings.NewReader(filterManifests), "app.yaml", &utils.ReadOptions{})
+	require.NoError(t, err)
+
+	k, f, err := filterDocs(docs, opts)
+	require.NoError(t, err)
+	for _, d := range k {
+		kept = append(kept, d.Object.GetKind()+"/"+d.Object.GetName())
+	}
+	for _, d := range f {
+		filtered = append(filtered, d.doc.Object.GetKind()+"/"+d.doc.Object.GetName()+" "+d.reason)
+	}
+	return kept, filtered
+}
+
+func TestFilterDocs(t *testing.T) {
+	t.Run("no filters", func(t *testing.T) {
+		kept, filtered := filterNames(t, &AtomicApplyOptions{})
+		assert.Len(t, kept, 4)
+		assert.Empty(t, filtered)
+	})
+
+	t.Run("selector", func(t *testing.T) {
+		kept, filtered := filterNames(t, &AtomicApplyOptions{Selector: "tier=frontend"})
+		assert.Equal(t, []string{"Deployment/frontend", "Service/frontend"}, kept)
+		assert.Equal(t, []string{
+			"CustomResourceDefinition/databases.example.com --selector",
+			"Deployment/backend --selector",
+		}, filtered)
+	})
+
+	t.Run("exclude kinds", func(t *testing.T) {
+		kept, _ := filterNames(t, &AtomicApplyOptions{ExcludeKinds: []string{"customresourcedefinition"}})
+		assert.Equal(t, []string{"Deployment/frontend", "Deployment/backend", "Service/frontend"}, kept)
+	})
+
+	t.Run("only kinds with group", func(t *testing.T) {
+		kept, filtered := filterNames(t, &AtomicApplyOptions{
+			OnlyKinds: []string{"Deployment.apps", "Service.example.com"},
+			Selector:  "tier!=backend",
+		})
+		assert.Equal(t, []string{"Deployment/frontend"}, kept)
+		assert.Contains(t, filtered, "Service/frontend --only-kinds")
+		assert.Contains(t, filtered, "Deployment/backend --selector")
+	})
+
+	t.Run("invalid selector", func(t *testing.T) {
+		_, _, err := filterDocs(nil, &AtomicApplyOptions{Selector: "tier in ("})
+		assert.Error(t, err)
+	})
+}
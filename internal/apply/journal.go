@@ -0,0 +1,310 @@
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashmap-kz/katomik/internal/utils"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// journalVersion is the format version of saved rollback plans.
+const journalVersion = 2
+
+// journal is the rollback plan of a run that failed with NoRollback: what it
+// changed in every cluster along with the backups, saved to a file so
+// RunRollback can revert the run later on.
+//
+//	Version       - format version, journalVersion
+//	Created       - when the run failed
+//	Release       - release the run was locked for
+//	LockNamespace - namespace of the release Lease
+//	Lock          - the run was locked, so is its rollback
+//	Clusters      - changes per cluster, in the order of the run
+type journal struct {
+	Version       int              `json:"version"`
+	Created       time.Time        `json:"created"`
+	Release       string           `json:"release,omitempty"`
+	LockNamespace string           `json:"lockNamespace,omitempty"`
+	Lock          bool             `json:"lock,omitempty"`
+	Clusters      []journalCluster `json:"clusters"`
+}
+
+// journalCluster holds the applied objects of one cluster, in plan order.
+// Context is the resolved name, also for a run on the current context.
+type journalCluster struct {
+	Context string        `json:"context"`
+	Items   []journalItem `json:"items"`
+}
+
+// journalItem is an applied applyItem. Only the identity of the object is
+// kept, not its applied content: deleting it and restoring the backup needs
+// nothing else, and the applied content may be decrypted Secret data.
+//
+//	Resource   - resource of the object
+//	Object     - the object identity
+//	Source     - where the object was read from
+//	Existed    - whether the object existed before (restore) or not (delete)
+//	Backup     - the object before the run, if it existed
+//	Dependants - backed up custom resources of a CRD, see dependants
+type journalItem struct {
+	Resource   schema.GroupVersionResource `json:"resource"`
+	Object     ObjectRef                   `json:"object"`
+	Source     utils.Source                `json:"source"`
+	Existed    bool                        `json:"existed"`
+	Backup     json.RawMessage             `json:"backup,omitempty"`
+	Dependants []json.RawMessage           `json:"dependants,omitempty"`
+}
+
+// defaultJournalFile is where the rollback plan is saved without a file
+// given, in the working directory.
+func defaultJournalFile(now time.Time) string {
+	return fmt.Sprintf("katomik-rollback-%s.json", now.UTC().Format("20060102T150405Z"))
+}
+
+// newJournal records the applied objects of every cluster.
+func newJournal(clusters []*cluster, runOpts *AtomicApplyRunOptions, now time.Time) (*journal, error) {
+	j := &journal{
+		Version:       journalVersion,
+		Created:       now.UTC(),
+		Release:       runOpts.ApplyOpts.Release,
+		LockNamespace: runOpts.ApplyOpts.LockNamespace,
+		Lock:          !runOpts.ApplyOpts.NoLock,
+	}
+	if j.LockNamespace == "" {
+		j.LockNamespace = targetNamespace(runOpts)
+	}
+
+	for _, c := range clusters {
+		// the current context is resolved, it may be another one at rollback
+		jc := journalCluster{Context: contextName(runOpts, c), Items: []journalItem{}}
+		if jc.Context == "" {
+			return nil, c.wrap(errors.New("cannot record the kube context of the run"))
+		}
+		for i := range c.plan {
+			it := &c.plan[i]
+			if !it.applied {
+				continue
+			}
+			gvk := it.obj.GroupVersionKind()
+			m, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if err != nil {
+				return nil, c.wrap(fmt.Errorf("%s: %w", it, err))
+			}
+			ji := journalItem{Resource: m.Resource, Object: *it.ref(), Source: it.src, Existed: it.existed, Backup: it.backup}
+			if it.deps != nil {
+				for _, u := range it.deps.objs {
+					b, err := u.MarshalJSON()
+					if err != nil {
+						return nil, c.wrap(fmt.Errorf("%s: %w", it, err))
+					}
+					ji.Dependants = append(ji.Dependants, b)
+				}
+			}
+			jc.Items = append(jc.Items, ji)
+		}
+		j.Clusters = append(j.Clusters, jc)
+	}
+	return j, nil
+}
+
+// hasSecrets reports whether the journal holds backups of Secrets.
+func (j *journal) hasSecrets() bool {
+	for _, jc := range j.Clusters {
+		for _, ji := range jc.Items {
+			if ji.Object.APIVersion == "v1" && ji.Object.Kind == "Secret" && len(ji.Backup) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// save writes the journal to path, readable by the owner only: the backups
+// may include Secrets.
+func (j *journal) save(path string) error {
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// loadJournal reads a rollback plan saved by a run.
+func loadJournal(path string) (*journal, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &journal{}
+	if err := json.Unmarshal(b, j); err != nil {
+		return nil, fmt.Errorf("%s: invalid rollback plan: %w", path, err)
+	}
+	if j.Version != journalVersion {
+		return nil, fmt.Errorf("%s: unsupported rollback plan version %d, expected %d", path, j.Version, journalVersion)
+	}
+	if len(j.Clusters) == 0 {
+		return nil, fmt.Errorf("%s: rollback plan has no clusters", path)
+	}
+	for i, jc := range j.Clusters {
+		if jc.Context == "" {
+			return nil, fmt.Errorf("%s: cluster %d of the rollback plan has no context", path, i)
+		}
+	}
+	return j, nil
+}
+
+// useContexts points runOpts at the clusters of the journal.
+func (j *journal) useContexts(runOpts *AtomicApplyRunOptions) {
+	if len(j.Clusters) > 1 {
+		runOpts.ApplyOpts.Contexts = make([]string, 0, len(j.Clusters))
+		for _, jc := range j.Clusters {
+			runOpts.ApplyOpts.Contexts = append(runOpts.ApplyOpts.Contexts, jc.Context)
+		}
+		return
+	}
+	runOpts.ApplyOpts.Contexts = nil
+	if runOpts.ConfigFlags != nil {
+		name := j.Clusters[0].Context
+		runOpts.ConfigFlags.Context = &name
+	}
+}
+
+// plan rebuilds the applied items of jc for rolling them back with dyn.
+func (jc *journalCluster) plan(dyn dynamic.Interface) ([]applyItem, error) {
+	plan := make([]applyItem, 0, len(jc.Items))
+	for _, ji := range jc.Items {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(ji.Object.APIVersion)
+		u.SetKind(ji.Object.Kind)
+		u.SetNamespace(ji.Object.Namespace)
+		u.SetName(ji.Object.Name)
+		var dr dynamic.ResourceInterface = dyn.Resource(ji.Resource)
+		if ns := u.GetNamespace(); ns != "" {
+			dr = dyn.Resource(ji.Resource).Namespace(ns)
+		}
+
+		it := applyItem{obj: u, dr: dr, src: ji.Source, existed: ji.Existed, backup: ji.Backup, applied: true}
+		if it.existed && len(it.backup) == 0 {
+			return nil, sourceError(it.src, fmt.Errorf("no backup of %s", &it))
+		}
+		if len(ji.Dependants) > 0 {
+			backup := &unstructured.Unstructured{}
+			if err := backup.UnmarshalJSON(ji.Backup); err != nil {
+				return nil, sourceError(it.src, err)
+			}
+			gvr, ok := crdResource(backup)
+			if !ok {
+				return nil, sourceError(it.src, fmt.Errorf("dependants of %s without a storage version", &it))
+			}
+			it.deps = &dependants{res: dyn.Resource(gvr)}
+			for _, b := range ji.Dependants {
+				d := &unstructured.Unstructured{}
+				if err := d.UnmarshalJSON(b); err != nil {
+					return nil, sourceError(it.src, err)
+				}
+				it.deps.objs = append(it.deps.objs, d)
+			}
+		}
+		plan = append(plan, it)
+	}
+	return plan, nil
+}
+
+// keepChanges handles a failed run with NoRollback: instead of rolling back
+// the rollback plan is saved, err is returned with ExitNotRolledBack.
+func keepChanges(rep *reporter, clusters []*cluster, runOpts *AtomicApplyRunOptions, err error) error {
+	now := time.Now()
+	path := runOpts.ApplyOpts.RollbackPlan
+	if path == "" {
+		path = defaultJournalFile(now)
+	}
+
+	j, jErr := newJournal(clusters, runOpts, now)
+	if jErr == nil {
+		jErr = j.save(path)
+	}
+	if jErr != nil {
+		return withExitCode(ExitNotRolledBack, errors.Join(err, fmt.Errorf("could not save the rollback plan: %w", jErr)))
+	}
+	rep.Printf("! changes kept (--no-rollback), revert them with: katomik rollback --plan %s\n", path)
+	what := "the backups of the changed objects"
+	if j.hasSecrets() {
+		what += ", Secrets included"
+	}
+	rep.Printf("! %s holds %s and is readable by its owner only, delete it once the run is reverted\n", path, what)
+	return withExitCode(ExitNotRolledBack, err)
+}
+
+// RunRollback reverts a run that failed with NoRollback, from the rollback
+// plan it saved to ApplyOpts.RollbackPlan. The objects are restored or
+// deleted and the result is verified like an immediate rollback; the
+// clusters are the ones of the run, the lock is its release Lease.
+//
+// Errors carry ExitInput for an unreadable plan, ExitLocked if the Lease is
+// held and ExitRollbackFailed if rolling back failed.
+func RunRollback(ctx context.Context, runOpts *AtomicApplyRunOptions) (err error) {
+	rep := newReporter(runOpts.Streams, runOpts.ApplyOpts.Output).withQuiet(runOpts.ApplyOpts.Quiet)
+	var clusters []*cluster
+	defer func() {
+		// nothing is applied, the result only tells whether it rolled back
+		rep.result(nil, err, err == nil)
+	}()
+
+	j, err := loadJournal(runOpts.ApplyOpts.RollbackPlan)
+	if err != nil {
+		return withExitCode(ExitInput, err)
+	}
+	opts := &runOpts.ApplyOpts
+	j.useContexts(runOpts)
+	opts.Release = j.Release
+	opts.LockNamespace = j.LockNamespace
+	opts.NoLock = !j.Lock
+
+	clusters, err = newClusters(runOpts, rep)
+	if err != nil {
+		return withExitCode(ExitInput, err)
+	}
+	rules, err := loadReadinessRules(opts, nil)
+	if err != nil {
+		return withExitCode(ExitInput, err)
+	}
+	for i, c := range clusters {
+		if c.plan, err = j.Clusters[i].plan(c.dyn); err != nil {
+			return withExitCode(ExitInput, c.wrap(err))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if !opts.NoLock {
+		defer releaseLocks(clusters)
+		if err := acquireLocks(ctx, clusters, runOpts, cancel); err != nil {
+			return err
+		}
+	}
+
+	rep.Printf("+ rolling back the run of %s\n", j.Created.Local().Format(time.RFC1123))
+	wait := &waitOptions{
+		rules:        rules,
+		timeout:      opts.Timeout,
+		watch:        !opts.NoWatch,
+		pollInterval: opts.PollInterval,
+	}
+	if wait.pollInterval <= 0 {
+		wait.pollInterval = DefaultPollInterval
+	}
+	undo := &rollbackOptions{
+		timeout:         opts.RollbackTimeout,
+		propagation:     opts.DeletePropagation,
+		forceFinalizers: opts.ForceFinalizers,
+		wait:            wait,
+	}
+	return withExitCode(ExitRollbackFailed, rollback(rep, clusters, undo))
+}
@@ -0,0 +1,102 @@
+package apply
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashmap-kz/katomik/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestJournal_RoundTrip(t *testing.T) {
+	c, dyn, _ := statusTestCluster(t)
+	c.name = "staging"
+	cur, err := dyn.Resource(configMapGVR).Namespace("default").Get(context.Background(), "cm", metav1.GetOptions{})
+	require.NoError(t, err)
+	changed := &c.plan[0]
+	require.NoError(t, changed.snapshot(cur))
+	changed.applied = true
+	created := applyItem{obj: testConfigMap("v1"), src: utils.Source{File: "new.yaml"}, applied: true}
+	created.obj.SetName("new")
+	c.plan = append(c.plan, created, applyItem{obj: testConfigMap("v1")})
+
+	runOpts := &AtomicApplyRunOptions{ApplyOpts: AtomicApplyOptions{Release: "web"}}
+	j, err := newJournal([]*cluster{c}, runOpts, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "default", j.LockNamespace)
+	path := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, j.save(path))
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm(), "the plan holds backups of Secrets")
+
+	loaded, err := loadJournal(path)
+	require.NoError(t, err)
+	assert.Equal(t, "web", loaded.Release)
+	require.Len(t, loaded.Clusters, 1)
+	assert.Equal(t, "staging", loaded.Clusters[0].Context)
+	plan, err := loaded.Clusters[0].plan(dyn)
+	require.NoError(t, err)
+	require.Len(t, plan, 2, "objects that were not applied are left out")
+
+	assert.True(t, plan[0].existed)
+	assert.JSONEq(t, string(changed.backup), string(plan[0].backup))
+	assert.Equal(t, "cm.yaml", plan[0].src.File)
+	_, err = plan[0].dr.Get(context.Background(), "cm", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.False(t, plan[1].existed)
+	assert.Equal(t, "new", plan[1].obj.GetName())
+	assert.Equal(t, "ConfigMap", plan[1].obj.GetKind())
+	assert.Equal(t, "default", plan[1].obj.GetNamespace())
+}
+
+func TestJournal_Secrets(t *testing.T) {
+	c, dyn, _ := statusTestCluster(t)
+	c.name = "staging"
+	secret := applyItem{obj: testObject("v1", "Secret", "default", "db"), existed: true, applied: true}
+	secret.obj.Object["stringData"] = map[string]interface{}{"password": "applied-s3cr3t"}
+	secret.backup = []byte(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"db","namespace":"default"}}`)
+	c.plan = []applyItem{secret}
+
+	j, err := newJournal([]*cluster{c}, &AtomicApplyRunOptions{}, time.Now())
+	require.NoError(t, err)
+	assert.True(t, j.hasSecrets())
+	path := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, j.save(path))
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "applied-s3cr3t", "only the identity of applied objects is saved")
+
+	loaded, err := loadJournal(path)
+	require.NoError(t, err)
+	plan, err := loaded.Clusters[0].plan(dyn)
+	require.NoError(t, err)
+	require.Len(t, plan, 1)
+	assert.Equal(t, &ObjectRef{APIVersion: "v1", Kind: "Secret", Namespace: "default", Name: "db"}, plan[0].ref())
+}
+
+func TestNewJournal_NoContext(t *testing.T) {
+	c, _, _ := statusTestCluster(t)
+	_, err := newJournal([]*cluster{c}, &AtomicApplyRunOptions{}, time.Now())
+	assert.Error(t, err, "a plan must not depend on the context current at rollback")
+}
+
+func TestLoadJournal_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"garbage":  "not json",
+		"version":  `{"version": 99, "clusters": [{"items": []}]}`,
+		"clusters": `{"version": 1}`,
+		"context":  `{"version": 2, "clusters": [{"items": []}]}`,
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err := loadJournal(path)
+		assert.Error(t, err, name)
+	}
+}
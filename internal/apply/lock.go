@@ -0,0 +1,73 @@
+package apply
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/hashmap-kz/katomik/internal/lock"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// acquireLocks takes the release Lease in every cluster so concurrent runs
+// targeting the same release (or namespace) cannot interleave. Losing a Lease
+// while the transaction is running calls cancel, which makes the run fail and
+// roll back. A Lease held by another run, or one that cannot be created (the
+// namespace does not exist yet, no RBAC for Leases), fails with ExitLocked.
+func acquireLocks(ctx context.Context, clusters []*cluster, runOpts *AtomicApplyRunOptions, cancel context.CancelFunc) error {
+	opts := lock.Options{
+		Namespace: runOpts.ApplyOpts.LockNamespace,
+		Name:      lock.LeaseName(runOpts.ApplyOpts.Release),
+		Timeout:   runOpts.ApplyOpts.LockTimeout,
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = targetNamespace(runOpts)
+	}
+
+	for _, c := range clusters {
+		slog.Debug("acquiring lock", "cluster", c.String(), "lease", opts.Namespace+"/"+opts.Name)
+		l, err := lock.Acquire(ctx, c.kube, opts,
+			func(holder string) {
+				c.rep.Printf("+ waiting for lock %s/%s held by %s\n", opts.Namespace, opts.Name, holder)
+			},
+			func(err error) {
+				c.rep.Println("✗", c.wrap(err))
+				cancel()
+			},
+		)
+		if err != nil {
+			return withExitCode(ExitLocked, c.wrap(lockError(err, opts.Namespace)))
+		}
+		c.lock = l
+	}
+	return nil
+}
+
+// lockError explains why the Lease in namespace could not be taken.
+func lockError(err error, namespace string) error {
+	switch {
+	case errors.Is(err, lock.ErrTimeout):
+		return err
+	case apierrors.IsNotFound(err):
+		return fmt.Errorf("cannot lock: %w (the lock namespace %q must exist before the run, see --lock-namespace and --no-lock)", err, namespace)
+	case apierrors.IsForbidden(err):
+		return fmt.Errorf("cannot lock: %w (get, create and update on leases.coordination.k8s.io in %q are needed, or --no-lock)", err, namespace)
+	default:
+		return fmt.Errorf("cannot lock: %w", err)
+	}
+}
+
+// releaseLocks frees the Leases taken by acquireLocks. Failures are only
+// reported, an unreleased Lease expires on its own.
+func releaseLocks(clusters []*cluster) {
+	for _, c := range clusters {
+		if c.lock == nil {
+			continue
+		}
+		if err := c.lock.Release(context.Background()); err != nil {
+			c.rep.Println("! could not release lock:", c.wrap(err))
+		}
+		c.lock = nil
+	}
+}
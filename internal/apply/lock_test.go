@@ -0,0 +1,44 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestAcquireLocks_CannotCreateLease(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err  error
+		hint string
+	}{
+		"namespace missing": {
+			err:  apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "team-a"),
+			hint: `the lock namespace "team-a" must exist before the run`,
+		},
+		"no rbac": {
+			err:  apierrors.NewForbidden(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, "katomik", nil),
+			hint: `get, create and update on leases.coordination.k8s.io in "team-a" are needed`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			kube := kubefake.NewClientset()
+			kube.PrependReactor("create", "leases", func(clienttesting.Action) (bool, runtime.Object, error) {
+				return true, nil, tc.err
+			})
+			c := &cluster{kube: kube, rep: testReporter()}
+			runOpts := &AtomicApplyRunOptions{ApplyOpts: AtomicApplyOptions{LockNamespace: "team-a"}}
+
+			err := acquireLocks(context.Background(), []*cluster{c}, runOpts, func() {})
+			require.Error(t, err)
+			assert.Equal(t, ExitLocked, ExitCode(err))
+			assert.Contains(t, err.Error(), tc.hint)
+		})
+	}
+}
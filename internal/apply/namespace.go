@@ -0,0 +1,130 @@
+package apply
+
+import (
+	"fmt"
+
+	"github.com/hashmap-kz/katomik/internal/utils"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// namespacePolicy defaults, enforces and rewrites the namespaces of the
+// objects in a plan.
+//
+//	target             - namespace from -n (or "default")
+//	enforce            - reject objects outside of target
+//	allowClusterScoped - with enforce, accept cluster-scoped objects
+//	rewrite            - move namespaced objects into target
+//	moved              - original namespaces that were rewritten to target,
+//	                     references to them are rewritten as well
+type namespacePolicy struct {
+	target             string
+	enforce            bool
+	allowClusterScoped bool
+	rewrite            bool
+	moved              map[string]struct{}
+}
+
+// targetNamespace returns the namespace given with -n, or "default".
+func targetNamespace(runOpts *AtomicApplyRunOptions) string {
+	if runOpts.ConfigFlags != nil && runOpts.ConfigFlags.Namespace != nil && *runOpts.ConfigFlags.Namespace != "" {
+		return *runOpts.ConfigFlags.Namespace
+	}
+	return "default"
+}
+
+func newNamespacePolicy(runOpts *AtomicApplyRunOptions) *namespacePolicy {
+	return &namespacePolicy{
+		target:             targetNamespace(runOpts),
+		enforce:            runOpts.ApplyOpts.EnforceNamespace,
+		allowClusterScoped: runOpts.ApplyOpts.AllowClusterScoped,
+		rewrite:            runOpts.ApplyOpts.RewriteNamespace,
+		moved:              make(map[string]struct{}),
+	}
+}
+
+// check sets the namespace of u according to the policy or fails when u is
+// not allowed in the target namespace.
+func (p *namespacePolicy) check(u *unstructured.Unstructured, namespaced bool, src utils.Source) error {
+	kn := fmt.Sprintf("%s/%s", u.GetKind(), u.GetName())
+
+	if !namespaced {
+		if p.enforce && !p.allowClusterScoped {
+			return sourceError(src, fmt.Errorf("%s: cluster-scoped object not allowed with --enforce-namespace (see --allow-cluster-scoped)", kn))
+		}
+		return nil
+	}
+
+	ns := u.GetNamespace()
+	switch {
+	case ns == "":
+		u.SetNamespace(p.target)
+	case ns == p.target:
+	case p.rewrite:
+		p.moved[ns] = struct{}{}
+		u.SetNamespace(p.target)
+	case p.enforce:
+		return sourceError(src, fmt.Errorf("%s: namespace %q is outside of the target namespace %q", kn, ns, p.target))
+	}
+	return nil
+}
+
+// rewriteRefs points namespace references in u that refer to a moved
+// namespace to the target namespace:
+//
+//   - ServiceAccount subjects of RoleBindings and ClusterRoleBindings
+//   - webhook services of admission webhook configurations
+//   - the service of APIServices
+//   - the conversion webhook service of CRDs
+func (p *namespacePolicy) rewriteRefs(u *unstructured.Unstructured) error {
+	if len(p.moved) == 0 {
+		return nil
+	}
+
+	switch u.GroupVersionKind().GroupKind().String() {
+	case "RoleBinding.rbac.authorization.k8s.io", "ClusterRoleBinding.rbac.authorization.k8s.io":
+		return p.rewriteList(u.Object, []string{"subjects"}, func(subject map[string]interface{}) error {
+			if subject["kind"] != "ServiceAccount" {
+				return nil
+			}
+			return p.rewriteField(subject, "namespace")
+		})
+	case "ValidatingWebhookConfiguration.admissionregistration.k8s.io",
+		"MutatingWebhookConfiguration.admissionregistration.k8s.io":
+		return p.rewriteList(u.Object, []string{"webhooks"}, func(webhook map[string]interface{}) error {
+			return p.rewriteField(webhook, "clientConfig", "service", "namespace")
+		})
+	case "APIService.apiregistration.k8s.io":
+		return p.rewriteField(u.Object, "spec", "service", "namespace")
+	case "CustomResourceDefinition.apiextensions.k8s.io":
+		return p.rewriteField(u.Object, "spec", "conversion", "webhook", "clientConfig", "service", "namespace")
+	}
+	return nil
+}
+
+func (p *namespacePolicy) rewriteField(obj map[string]interface{}, fields ...string) error {
+	ns, found, err := unstructured.NestedString(obj, fields...)
+	if err != nil || !found {
+		return err
+	}
+	if _, ok := p.moved[ns]; !ok {
+		return nil
+	}
+	return unstructured.SetNestedField(obj, p.target, fields...)
+}
+
+func (p *namespacePolicy) rewriteList(obj map[string]interface{}, fields []string, fn func(map[string]interface{}) error) error {
+	items, found, err := unstructured.NestedSlice(obj, fields...)
+	if err != nil || !found {
+		return err
+	}
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return unstructured.SetNestedSlice(obj, items, fields...)
+}
@@ -0,0 +1,97 @@
+package apply
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashmap-kz/katomik/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/utils/ptr"
+)
+
+func testNamespacePolicy(opts *AtomicApplyOptions) *namespacePolicy {
+	cfg := genericclioptions.NewConfigFlags(false)
+	cfg.Namespace = ptr.To("team-a")
+	return newNamespacePolicy(&AtomicApplyRunOptions{ConfigFlags: cfg, ApplyOpts: *opts})
+}
+
+func readObject(t *testing.T, manifest string) *unstructured.Unstructured {
+	t.Helper()
+	objs, err := utils.ReadObjects(strings.NewReader(manifest))
+	require.NoError(t, err)
+	require.Len(t, objs, 1)
+	return objs[0]
+}
+
+const kubeSystemConfigMap = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+  namespace: kube-system
+`
+
+func TestNamespacePolicy_Default(t *testing.T) {
+	p := testNamespacePolicy(&AtomicApplyOptions{})
+
+	u := readObject(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n")
+	require.NoError(t, p.check(u, true, utils.Source{}))
+	assert.Equal(t, "team-a", u.GetNamespace())
+
+	// without enforcement hardcoded namespaces are kept
+	u = readObject(t, kubeSystemConfigMap)
+	require.NoError(t, p.check(u, true, utils.Source{}))
+	assert.Equal(t, "kube-system", u.GetNamespace())
+}
+
+func TestNamespacePolicy_Enforce(t *testing.T) {
+	p := testNamespacePolicy(&AtomicApplyOptions{EnforceNamespace: true})
+
+	err := p.check(readObject(t, kubeSystemConfigMap), true, utils.Source{File: "cm.yaml", Line: 2})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `cm.yaml:2 (doc 1): ConfigMap/cm: namespace "kube-system" is outside of the target namespace "team-a"`)
+
+	ns := readObject(t, "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: other\n")
+	assert.Error(t, p.check(ns, false, utils.Source{}))
+
+	p = testNamespacePolicy(&AtomicApplyOptions{EnforceNamespace: true, AllowClusterScoped: true})
+	assert.NoError(t, p.check(ns, false, utils.Source{}))
+}
+
+func TestNamespacePolicy_Rewrite(t *testing.T) {
+	p := testNamespacePolicy(&AtomicApplyOptions{EnforceNamespace: true, RewriteNamespace: true})
+
+	rb := readObject(t, `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: app
+  namespace: app
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: app
+subjects:
+  - kind: ServiceAccount
+    name: app
+    namespace: app
+  - kind: ServiceAccount
+    name: monitoring
+    namespace: monitoring
+  - kind: Group
+    name: app
+`)
+	require.NoError(t, p.check(rb, true, utils.Source{}))
+	assert.Equal(t, "team-a", rb.GetNamespace())
+
+	require.NoError(t, p.rewriteRefs(rb))
+	subjects, _, err := unstructured.NestedSlice(rb.Object, "subjects")
+	require.NoError(t, err)
+	assert.Equal(t, "team-a", subjects[0].(map[string]interface{})["namespace"])
+	// namespaces that are not part of the manifest set are left alone
+	assert.Equal(t, "monitoring", subjects[1].(map[string]interface{})["namespace"])
+	assert.NotContains(t, subjects[2].(map[string]interface{}), "namespace")
+}
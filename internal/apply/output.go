@@ -0,0 +1,256 @@
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hashmap-kz/katomik/internal/utils"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats of the machine-readable event stream.
+//
+//	OutputJSON - one JSON event per line (NDJSON)
+//	OutputYAML - one YAML document per event
+const (
+	OutputJSON = "json"
+	OutputYAML = "yaml"
+)
+
+// Event types, see Event.
+const (
+	EventFiltered = "filtered"
+	EventInvalid  = "invalid"
+	EventPlan     = "plan"
+	EventApplied  = "applied"
+	EventDrift    = "drift"
+	EventStatus   = "status"
+	EventRollback = "rollback"
+	EventVerify   = "verify"
+	EventResult   = "result"
+)
+
+// Actions carried by plan, applied, rollback and verify events.
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionRestore   = "restore"
+	ActionDelete    = "delete"
+	ActionKeep      = "keep"
+	ActionUnchanged = "unchanged"
+)
+
+// ObjectRef identifies an object in events.
+type ObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// Result summarizes a run in the final result event.
+//
+//	Success    - every object was applied and became ready
+//	RolledBack - the changes were rolled back
+//	Applied    - number of objects applied
+//	Drifted    - number of objects changed by someone else during the run
+//	Unchanged  - number of objects left alone, applying would not change them
+type Result struct {
+	Success    bool `json:"success"`
+	RolledBack bool `json:"rolledBack"`
+	Applied    int  `json:"applied"`
+	Drifted    int  `json:"drifted"`
+	Unchanged  int  `json:"unchanged"`
+}
+
+// Event is a single record of the machine-readable output (-o json|yaml).
+// Only the fields relevant for Type are set.
+type Event struct {
+	Type       string     `json:"type"`
+	Time       time.Time  `json:"time"`
+	Cluster    string     `json:"cluster,omitempty"`
+	Object     *ObjectRef `json:"object,omitempty"`
+	Source     string     `json:"source,omitempty"`
+	Action     string     `json:"action,omitempty"`
+	Status     string     `json:"status,omitempty"`
+	Message    string     `json:"message,omitempty"`
+	DurationMS int64      `json:"durationMs,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Result     *Result    `json:"result,omitempty"`
+}
+
+// reporter is the single sink of everything a run prints. Human-oriented
+// lines and tables go to the IOStreams; with a machine-readable format events
+// are written to Out and the human output moves to ErrOut, so Out stays
+// parseable.
+//
+// A reporter may be shared between goroutines; forCluster returns a copy that
+// tags events with the cluster name and shares the lock.
+//
+// When reports are requested (see withReports) every event is recorded as
+// well, the reports are rendered from them once the result is known.
+type reporter struct {
+	human   io.Writer
+	events  io.Writer
+	format  string
+	cluster string
+	start   time.Time
+	mu      *sync.Mutex
+	reports *reports
+}
+
+func newReporter(streams genericiooptions.IOStreams, format string) *reporter {
+	r := &reporter{
+		human:  streams.Out,
+		format: format,
+		start:  time.Now(),
+		mu:     &sync.Mutex{},
+	}
+	if format != "" {
+		r.human = streams.ErrOut
+		r.events = streams.Out
+	}
+	if r.human == nil {
+		r.human = io.Discard
+	}
+	return r
+}
+
+// withQuiet discards the human-oriented output, events are still written.
+func (r *reporter) withQuiet(quiet bool) *reporter {
+	if quiet {
+		r.human = io.Discard
+	}
+	return r
+}
+
+// withReports makes the reporter record events and write a JUnit and/or a
+// Markdown report when the result is reported. Empty paths disable a report.
+func (r *reporter) withReports(junitFile, markdownFile string) *reporter {
+	if junitFile != "" || markdownFile != "" {
+		r.reports = &reports{junitFile: junitFile, markdownFile: markdownFile}
+	}
+	return r
+}
+
+// forCluster returns a reporter tagging events with the cluster name.
+func (r *reporter) forCluster(name string) *reporter {
+	c := *r
+	c.cluster = name
+	return &c
+}
+
+// Printf writes a line of human-oriented output.
+func (r *reporter) Printf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = fmt.Fprintf(r.human, format, args...)
+}
+
+// Println writes a line of human-oriented output.
+func (r *reporter) Println(args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = fmt.Fprintln(r.human, args...)
+}
+
+// Write writes human-oriented output as is (tables).
+func (r *reporter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.human.Write(p)
+}
+
+// emit writes an event if a machine-readable format was requested and
+// records it for the reports.
+func (r *reporter) emit(e *Event) {
+	e.Time = time.Now().UTC()
+	if e.Cluster == "" {
+		e.Cluster = r.cluster
+	}
+	if r.reports != nil {
+		r.mu.Lock()
+		r.reports.events = append(r.reports.events, *e)
+		r.mu.Unlock()
+	}
+	if r.events == nil {
+		return
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+	if r.format == OutputYAML {
+		b, err = yaml.Marshal(e)
+		b = append([]byte("---\n"), b...)
+	} else {
+		b, err = json.Marshal(e)
+		b = append(b, '\n')
+	}
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = r.events.Write(b)
+}
+
+// result reports the outcome of the run: a summary line for humans and the
+// final result event. err is the failure, nil on success.
+func (r *reporter) result(clusters []*cluster, err error, rolledBack bool) {
+	res := &Result{Success: err == nil, RolledBack: rolledBack}
+	for _, c := range clusters {
+		for i := range c.plan {
+			if c.plan[i].applied {
+				res.Applied++
+			}
+			if c.plan[i].drift != "" {
+				res.Drifted++
+			}
+			if c.plan[i].unchanged {
+				res.Unchanged++
+			}
+		}
+	}
+	r.emit(&Event{
+		Type:       EventResult,
+		DurationMS: since(r.start),
+		Error:      errorString(err),
+		Result:     res,
+	})
+
+	if r.reports != nil {
+		if err := r.reports.write(); err != nil {
+			r.Println("! could not write report:", err)
+		}
+	}
+}
+
+// docRef identifies a decoded document in events.
+func docRef(d utils.Document) *ObjectRef {
+	return &ObjectRef{
+		APIVersion: d.Object.GetAPIVersion(),
+		Kind:       d.Object.GetKind(),
+		Namespace:  d.Object.GetNamespace(),
+		Name:       d.Object.GetName(),
+	}
+}
+
+// since returns the milliseconds elapsed since start.
+func since(start time.Time) int64 {
+	return time.Since(start).Milliseconds()
+}
+
+// errorString returns err's message, or "" for nil.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
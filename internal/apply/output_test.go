@@ -0,0 +1,75 @@
+package apply
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+func TestReporter_JSON(t *testing.T) {
+	streams, _, out, errOut := genericiooptions.NewTestIOStreams()
+	rep := newReporter(streams, OutputJSON)
+
+	it := &applyItem{obj: testConfigMap("v1"), applied: true}
+	rep.forCluster("east").emit(&Event{Type: EventApplied, Object: it.ref(), Action: it.action(), DurationMS: 5})
+	rep.Println("✓ Success")
+	rep.result([]*cluster{{plan: []applyItem{*it}}}, errors.New("boom"), true)
+
+	// human output does not end up between the events
+	assert.Equal(t, "✓ Success\n", errOut.String())
+
+	var events []Event
+	sc := bufio.NewScanner(strings.NewReader(out.String()))
+	for sc.Scan() {
+		var e Event
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &e))
+		events = append(events, e)
+	}
+	require.Len(t, events, 2)
+
+	assert.Equal(t, EventApplied, events[0].Type)
+	assert.Equal(t, "east", events[0].Cluster)
+	assert.Equal(t, &ObjectRef{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "cm"}, events[0].Object)
+	assert.Equal(t, ActionCreate, events[0].Action)
+	assert.Equal(t, int64(5), events[0].DurationMS)
+
+	assert.Equal(t, EventResult, events[1].Type)
+	assert.Equal(t, "boom", events[1].Error)
+	assert.Equal(t, &Result{Success: false, RolledBack: true, Applied: 1}, events[1].Result)
+}
+
+func TestReporter_YAML(t *testing.T) {
+	streams, _, out, _ := genericiooptions.NewTestIOStreams()
+	rep := newReporter(streams, OutputYAML)
+	rep.emit(&Event{Type: EventRollback, Action: ActionDelete})
+
+	assert.True(t, strings.HasPrefix(out.String(), "---\n"))
+	assert.Contains(t, out.String(), "type: rollback\n")
+	assert.Contains(t, out.String(), "action: delete\n")
+}
+
+func TestReporter_Human(t *testing.T) {
+	streams, _, out, errOut := genericiooptions.NewTestIOStreams()
+	rep := newReporter(streams, "")
+	rep.emit(&Event{Type: EventPlan})
+	rep.Printf("+ %s\n", "watching")
+
+	assert.Equal(t, "+ watching\n", out.String())
+	assert.Empty(t, errOut.String())
+}
+
+func TestReporter_Quiet(t *testing.T) {
+	streams, _, out, errOut := genericiooptions.NewTestIOStreams()
+	rep := newReporter(streams, OutputJSON).withQuiet(true)
+	rep.Println("✓ Success")
+	rep.emit(&Event{Type: EventPlan})
+
+	assert.Empty(t, errOut.String())
+	assert.Contains(t, out.String(), `"type":"plan"`)
+}
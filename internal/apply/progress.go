@@ -0,0 +1,232 @@
+package apply
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hashmap-kz/katomik/internal/printer"
+	"golang.org/x/term"
+	pollEvent "sigs.k8s.io/cli-utils/pkg/kstatus/polling/event"
+	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+// progressRow is the readiness state of one watched resource.
+//
+//	status  - last observed kstatus, empty until the first poll
+//	message - status message of the last poll
+//	elapsed - time until the resource became Current, 0 while it is not
+type progressRow struct {
+	id      object.ObjMetadata
+	status  kstatus.Status
+	message string
+	elapsed time.Duration
+}
+
+// progress renders the readiness of the watched resources. On a terminal the
+// whole table (every resource with its status, message and elapsed time plus a
+// "N/M Current" line) is redrawn in place; otherwise every status change is
+// logged as an appended line. A table taller than the terminal collapses the
+// rows that do not fit, Current ones first, into a "… N more" line. A table taller than the terminal collapses the
+// rows that do not fit, Current ones first, into a "… N more" line.
+type progress struct {
+	rep     *reporter
+	calcLen *printer.Len
+	start   time.Time
+	rows    []*progressRow
+	byID    map[object.ObjMetadata]*progressRow
+
+	// live mode only
+	live   bool
+	width  int
+	height int
+	drawn  int
+
+	mu sync.Mutex
+}
+
+func newProgress(rep *reporter, resources []object.ObjMetadata) *progress {
+	p := &progress{
+		rep:     rep,
+		calcLen: printer.CalcLen(resources),
+		start:   time.Now(),
+		byID:    make(map[object.ObjMetadata]*progressRow, len(resources)),
+	}
+	for _, id := range resources {
+		row := &progressRow{id: id}
+		p.rows = append(p.rows, row)
+		p.byID[id] = row
+	}
+	p.width, p.height, p.live = rep.terminalSize()
+	if slog.Default().Enabled(context.Background(), slog.LevelInfo) {
+		// log lines on stderr would tear the in-place redraw apart
+		p.live = false
+	}
+	return p
+}
+
+// update records a polled status.
+func (p *progress) update(rs *pollEvent.ResourceStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	row, ok := p.byID[rs.Identifier]
+	if !ok || (row.status == rs.Status && row.message == rs.Message) {
+		return
+	}
+	changed := row.status != rs.Status
+	row.status = rs.Status
+	row.message = rs.Message
+	if rs.Status == kstatus.CurrentStatus && row.elapsed == 0 {
+		row.elapsed = time.Since(p.start)
+	}
+
+	if p.live {
+		p.draw()
+		return
+	}
+	if changed {
+		p.rep.Printf("| %s  (%d/%d Current)\n", p.line(row), p.current(), len(p.rows))
+	}
+}
+
+// tick redraws the live table so elapsed times keep moving.
+func (p *progress) tick() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.live {
+		p.draw()
+	}
+}
+
+// finish draws the final state.
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.live {
+		p.draw()
+		return
+	}
+	p.rep.Printf("| %d/%d Current after %s\n", p.current(), len(p.rows), time.Since(p.start).Round(time.Second))
+}
+
+func (p *progress) current() int {
+	n := 0
+	for _, row := range p.rows {
+		if row.status == kstatus.CurrentStatus {
+			n++
+		}
+	}
+	return n
+}
+
+// line formats a row as "Kind/name namespace status elapsed message".
+func (p *progress) line(row *progressRow) string {
+	ns := row.id.Namespace
+	if ns == "" {
+		ns = "(cluster)"
+	}
+	kn := fmt.Sprintf("%s/%s", row.id.GroupKind.Kind, row.id.Name)
+
+	status := string(row.status)
+	if status == "" {
+		status = "Pending"
+	}
+	elapsed := row.elapsed
+	if elapsed == 0 {
+		elapsed = time.Since(p.start)
+	}
+
+	return fmt.Sprintf("%-*s %-*s %-12s %6s  %s",
+		p.calcLen.KindNameMaxLen, kn,
+		p.calcLen.NamespaceMaxLen, ns,
+		status,
+		elapsed.Round(time.Second),
+		row.message,
+	)
+}
+
+// draw moves the cursor back over the previous drawing and renders the table
+// again. Lines are cut to the terminal width and the table to the terminal
+// height so the line count stays exact: the cursor cannot move up past the
+// top of the screen.
+func (p *progress) draw() {
+	var buf bytes.Buffer
+	if p.drawn > 0 {
+		// cursor up, clear to the end of the screen
+		fmt.Fprintf(&buf, "\x1b[%dA\x1b[J", p.drawn)
+	}
+
+	rows := p.visibleRows()
+	lines := make([]string, 0, len(rows)+2)
+	for _, row := range rows {
+		mark := " "
+		if row.status == kstatus.CurrentStatus {
+			mark = "✓"
+		}
+		lines = append(lines, mark+" "+p.line(row))
+	}
+	if hidden := len(p.rows) - len(rows); hidden > 0 {
+		lines = append(lines, fmt.Sprintf("… %d more", hidden))
+	}
+	lines = append(lines, fmt.Sprintf("%d/%d Current · %s elapsed",
+		p.current(), len(p.rows), time.Since(p.start).Round(time.Second)))
+
+	for _, l := range lines {
+		buf.WriteString(truncate(l, p.width))
+		buf.WriteByte('\n')
+	}
+	p.drawn = len(lines)
+	_, _ = p.rep.Write(buf.Bytes())
+}
+
+// visibleRows returns the rows that fit on the terminal together with the
+// summary line, the "… N more" line and the line of the cursor. Current rows
+// are left out first, the ones still waited for are more interesting.
+func (p *progress) visibleRows() []*progressRow {
+	if p.height <= 0 || len(p.rows)+2 <= p.height {
+		return p.rows
+	}
+	keep := max(p.height-3, 0)
+	skipCurrent := len(p.rows) - keep
+	rows := make([]*progressRow, 0, len(p.rows))
+	for _, row := range p.rows {
+		if skipCurrent > 0 && row.status == kstatus.CurrentStatus {
+			skipCurrent--
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows[:keep]
+}
+
+// truncate cuts s to at most width runes (no limit if width <= 0).
+func truncate(s string, width int) string {
+	s = strings.TrimRight(s, " ")
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:width-1]) + "…"
+}
+
+// terminalSize reports whether human output goes to a terminal and its width
+// and height, 80x24 if the size cannot be determined.
+func (r *reporter) terminalSize() (int, int, bool) {
+	f, ok := r.human.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return 0, 0, false
+	}
+	width, height, err := term.GetSize(int(f.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24, true
+	}
+	return width, height, true
+}
@@ -0,0 +1,96 @@
+package apply
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	pollEvent "sigs.k8s.io/cli-utils/pkg/kstatus/polling/event"
+	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+func progressIDs() []object.ObjMetadata {
+	return []object.ObjMetadata{
+		{GroupKind: schema.GroupKind{Kind: "ConfigMap"}, Namespace: "default", Name: "cm"},
+		{GroupKind: schema.GroupKind{Group: "apps", Kind: "Deployment"}, Namespace: "default", Name: "web"},
+	}
+}
+
+func TestProgress_Plain(t *testing.T) {
+	streams, _, out, _ := genericiooptions.NewTestIOStreams()
+	ids := progressIDs()
+	p := newProgress(newReporter(streams, ""), ids)
+	assert.False(t, p.live)
+
+	p.update(&pollEvent.ResourceStatus{Identifier: ids[1], Status: kstatus.InProgressStatus, Message: "0/1 replicas"})
+	// message-only changes are not logged in plain mode
+	p.update(&pollEvent.ResourceStatus{Identifier: ids[1], Status: kstatus.InProgressStatus, Message: "0/1 ready"})
+	p.update(&pollEvent.ResourceStatus{Identifier: ids[0], Status: kstatus.CurrentStatus})
+	p.finish()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "Deployment/web")
+	assert.Contains(t, lines[0], "InProgress")
+	assert.Contains(t, lines[0], "(0/2 Current)")
+	assert.Contains(t, lines[1], "ConfigMap/cm")
+	assert.Contains(t, lines[1], "(1/2 Current)")
+	assert.Contains(t, lines[2], "1/2 Current after")
+	assert.NotContains(t, out.String(), "\x1b[")
+}
+
+func TestProgress_Live(t *testing.T) {
+	streams, _, out, _ := genericiooptions.NewTestIOStreams()
+	ids := progressIDs()
+	p := newProgress(newReporter(streams, ""), ids)
+	p.live = true
+
+	p.update(&pollEvent.ResourceStatus{Identifier: ids[0], Status: kstatus.CurrentStatus})
+	first := out.String()
+	assert.NotContains(t, first, "\x1b[")
+	assert.Contains(t, first, "✓ ConfigMap/cm")
+	assert.Contains(t, first, "Pending")
+	assert.Contains(t, first, "1/2 Current")
+
+	out.Reset()
+	p.update(&pollEvent.ResourceStatus{Identifier: ids[1], Status: kstatus.CurrentStatus})
+	// the previous three lines are overwritten in place
+	assert.True(t, strings.HasPrefix(out.String(), "\x1b[3A\x1b[J"))
+	assert.Contains(t, out.String(), "2/2 Current")
+}
+
+func TestProgress_LiveCollapsed(t *testing.T) {
+	streams, _, out, _ := genericiooptions.NewTestIOStreams()
+	ids := progressIDs()
+	for _, name := range []string{"a", "b"} {
+		ids = append(ids, object.ObjMetadata{GroupKind: schema.GroupKind{Kind: "Secret"}, Namespace: "default", Name: name})
+	}
+	p := newProgress(newReporter(streams, ""), ids)
+	p.live = true
+	p.height = 5
+
+	p.update(&pollEvent.ResourceStatus{Identifier: ids[0], Status: kstatus.CurrentStatus})
+	// two rows, the "more" line and the summary leave the cursor on screen;
+	// the Current ConfigMap is collapsed first
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "Deployment/web")
+	assert.Contains(t, lines[1], "Secret/a")
+	assert.Equal(t, "… 2 more", lines[2])
+	assert.Contains(t, lines[3], "1/4 Current")
+
+	out.Reset()
+	p.update(&pollEvent.ResourceStatus{Identifier: ids[1], Status: kstatus.CurrentStatus})
+	assert.True(t, strings.HasPrefix(out.String(), "\x1b[4A\x1b[J"))
+	assert.Contains(t, out.String(), "Secret/b")
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "abc", truncate("abc   ", 0))
+	assert.Equal(t, "abc", truncate("abc", 3))
+	assert.Equal(t, "ab…", truncate("abcd", 3))
+	assert.Equal(t, "✓ …", truncate("✓ ConfigMap", 3))
+}
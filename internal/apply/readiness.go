@@ -0,0 +1,30 @@
+package apply
+
+import (
+	"fmt"
+
+	"github.com/hashmap-kz/katomik/internal/readiness"
+	"github.com/hashmap-kz/katomik/internal/utils"
+)
+
+// loadReadinessRules reads the rules file (if any) and checks the rules and
+// wait annotations of every document, so a typo in a ready-when annotation
+// fails before anything is applied rather than after the timeout.
+func loadReadinessRules(opts *AtomicApplyOptions, docs []utils.Document) (*readiness.Rules, error) {
+	rules := &readiness.Rules{}
+	if opts.ReadinessRules != "" {
+		var err error
+		if rules, err = readiness.LoadFile(opts.ReadinessRules); err != nil {
+			return nil, fmt.Errorf("loading readiness rules: %w", err)
+		}
+	}
+	for _, d := range docs {
+		if _, _, err := rules.For(d.Object); err != nil {
+			return nil, sourceError(d.Source, err)
+		}
+		if _, _, err := readiness.Wait(d.Object, 0); err != nil {
+			return nil, sourceError(d.Source, err)
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,385 @@
+package apply
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// reports renders the recorded events of a run into the CI reports requested
+// with --report-junit and --report-markdown.
+type reports struct {
+	junitFile    string
+	markdownFile string
+	events       []Event
+}
+
+// resourceReport is the outcome of a single object, folded from its events.
+type resourceReport struct {
+	cluster     string
+	ref         ObjectRef
+	source      string
+	action      string
+	applied     bool
+	applyErr    string
+	applyMS     int64
+	status      string
+	statusMsg   string
+	readyMS     int64
+	drift       string
+	rollback    string
+	rollbackErr string
+	invalid     []string
+}
+
+func (rr *resourceReport) name() string {
+	if rr.ref.Namespace == "" {
+		return fmt.Sprintf("%s/%s", rr.ref.Kind, rr.ref.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", rr.ref.Kind, rr.ref.Namespace, rr.ref.Name)
+}
+
+// outcome classifies the object for the reports: "failed" (with the failure
+// type and message), "skipped" (with the reason) or "passed".
+func (rr *resourceReport) outcome(success bool) (state, kind, message string) {
+	switch {
+	case len(rr.invalid) > 0:
+		return "failed", "validation", strings.Join(rr.invalid, "\n")
+	case rr.applyErr != "":
+		return "failed", "apply", rr.applyErr
+	case rr.action == ActionUnchanged:
+		return "skipped", "", "unchanged"
+	case !rr.applied && !success:
+		return "skipped", "", "not applied"
+	case rr.status == "" && !success:
+		return "skipped", "", "readiness not checked"
+	case rr.status != "" && rr.status != "Current":
+		msg := rr.status
+		if rr.statusMsg != "" {
+			msg += ": " + rr.statusMsg
+		}
+		return "failed", "readiness", msg
+	default:
+		return "passed", "", ""
+	}
+}
+
+// summary is the folded view of all recorded events.
+type summary struct {
+	resources []*resourceReport
+	result    *Event
+	filtered  int
+}
+
+func (r *reports) summarize() *summary {
+	s := &summary{}
+	index := make(map[string]*resourceReport)
+
+	get := func(e *Event) *resourceReport {
+		key := e.Cluster + "|" + e.Object.APIVersion + "|" + e.Object.Kind + "|" + e.Object.Namespace + "|" + e.Object.Name
+		rr, ok := index[key]
+		if !ok {
+			rr = &resourceReport{cluster: e.Cluster, ref: *e.Object, source: e.Source}
+			index[key] = rr
+			s.resources = append(s.resources, rr)
+		}
+		return rr
+	}
+
+	for i := range r.events {
+		e := &r.events[i]
+		if e.Type == EventResult {
+			s.result = e
+			continue
+		}
+		if e.Type == EventFiltered {
+			s.filtered++
+			continue
+		}
+		if e.Object == nil {
+			continue
+		}
+
+		rr := get(e)
+		switch e.Type {
+		case EventInvalid:
+			rr.invalid = append(rr.invalid, e.Error)
+		case EventPlan:
+			rr.action = e.Action
+		case EventApplied:
+			rr.applyMS = e.DurationMS
+			rr.applied = e.Error == ""
+			rr.applyErr = e.Error
+		case EventDrift:
+			rr.drift = e.Message
+		case EventStatus:
+			rr.status = e.Status
+			rr.statusMsg = e.Message
+			rr.readyMS = e.DurationMS
+		case EventRollback:
+			rr.rollback = e.Action
+			rr.rollbackErr = e.Error
+		case EventVerify:
+			if e.Error != "" {
+				rr.rollbackErr = e.Error
+			}
+		}
+	}
+
+	if s.result == nil {
+		s.result = &Event{Type: EventResult, Result: &Result{}}
+	}
+	return s
+}
+
+func (r *reports) write() error {
+	s := r.summarize()
+	if r.junitFile != "" {
+		b, err := renderJUnit(s)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(r.junitFile, b, 0o600); err != nil {
+			return err
+		}
+	}
+	if r.markdownFile != "" {
+		if err := os.WriteFile(r.markdownFile, []byte(renderMarkdown(s)), 0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JUnit XML, the subset understood by common CI systems.
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func seconds(ms int64) string {
+	return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
+
+func renderJUnit(s *summary) ([]byte, error) {
+	success := s.result.Result != nil && s.result.Result.Success
+	root := junitTestSuites{Name: "katomik", Time: seconds(s.result.DurationMS)}
+
+	suites := make(map[string]*junitTestSuite)
+	suiteMS := make(map[string]int64)
+	var order []string
+	suite := func(cluster string) *junitTestSuite {
+		ts, ok := suites[cluster]
+		if !ok {
+			name := "katomik"
+			if cluster != "" {
+				name += " (" + cluster + ")"
+			}
+			ts = &junitTestSuite{Name: name, Timestamp: s.result.Time.Format(time.RFC3339)}
+			suites[cluster] = ts
+			order = append(order, cluster)
+		}
+		return ts
+	}
+
+	failed := 0
+	for _, rr := range s.resources {
+		ts := suite(rr.cluster)
+		tc := junitTestCase{
+			ClassName: rr.ref.APIVersion + "." + rr.ref.Kind,
+			Name:      rr.name(),
+			File:      rr.source,
+			Time:      seconds(rr.applyMS + rr.readyMS),
+		}
+		state, kind, message := rr.outcome(success)
+		switch state {
+		case "failed":
+			tc.Failure = &junitFailure{Message: firstLine(message), Type: kind, Text: message}
+			ts.Failures++
+			failed++
+		case "skipped":
+			tc.Skipped = &junitSkipped{Message: message}
+			ts.Skipped++
+		}
+		ts.Tests++
+		ts.Cases = append(ts.Cases, tc)
+		suiteMS[rr.cluster] += rr.applyMS + rr.readyMS
+	}
+
+	// a run can fail without any object to blame (lock, connection, ...)
+	if !success && failed == 0 {
+		ts := suite("")
+		ts.Tests++
+		ts.Failures++
+		ts.Cases = append(ts.Cases, junitTestCase{
+			ClassName: "katomik",
+			Name:      "apply",
+			Time:      seconds(s.result.DurationMS),
+			Failure:   &junitFailure{Message: firstLine(s.result.Error), Type: "run", Text: s.result.Error},
+		})
+	}
+
+	for _, cluster := range order {
+		ts := suites[cluster]
+		ts.Time = seconds(suiteMS[cluster])
+		root.Tests += ts.Tests
+		root.Failures += ts.Failures
+		root.Skipped += ts.Skipped
+		root.Suites = append(root.Suites, *ts)
+	}
+
+	b, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+func renderMarkdown(s *summary) string {
+	res := s.result.Result
+	if res == nil {
+		res = &Result{}
+	}
+
+	var b strings.Builder
+	switch {
+	case res.Success:
+		b.WriteString("## ✅ katomik apply succeeded\n\n")
+	case res.RolledBack:
+		b.WriteString("## ❌ katomik apply failed and was rolled back\n\n")
+	default:
+		b.WriteString("## ❌ katomik apply failed\n\n")
+	}
+
+	fmt.Fprintf(&b, "Duration: %s · Applied: %d · Unchanged: %d · Drifted: %d",
+		time.Duration(s.result.DurationMS)*time.Millisecond, res.Applied, res.Unchanged, res.Drifted)
+	if s.filtered > 0 {
+		fmt.Fprintf(&b, " · Filtered out: %d", s.filtered)
+	}
+	b.WriteString("\n\n")
+	if s.result.Error != "" {
+		fmt.Fprintf(&b, "```\n%s\n```\n\n", s.result.Error)
+	}
+
+	clusters := map[string]bool{}
+	for _, rr := range s.resources {
+		clusters[rr.cluster] = true
+	}
+	withCluster := len(clusters) > 1 || !clusters[""]
+
+	if len(s.resources) > 0 {
+		b.WriteString("### Plan\n\n")
+		header := "| Resource | Action | Source | Status | Apply | Ready |\n|---|---|---|---|---|---|\n"
+		if withCluster {
+			header = "| Cluster | Resource | Action | Source | Status | Apply | Ready |\n|---|---|---|---|---|---|---|\n"
+		}
+		b.WriteString(header)
+		for _, rr := range s.resources {
+			state, _, message := rr.outcome(res.Success)
+			status := rr.status
+			switch state {
+			case "failed":
+				status = "❌ " + oneLine(message)
+			case "skipped":
+				status = "⏭ " + message
+			}
+			row := []string{
+				"`" + rr.name() + "`",
+				rr.action,
+				rr.source,
+				status,
+				msOrDash(rr.applyMS, rr.applied),
+				msOrDash(rr.readyMS, rr.status == "Current"),
+			}
+			if withCluster {
+				row = append([]string{rr.cluster}, row...)
+			}
+			b.WriteString("| " + strings.Join(escapeCells(row), " | ") + " |\n")
+		}
+		b.WriteString("\n")
+	}
+
+	var rolledBack []*resourceReport
+	for _, rr := range s.resources {
+		if rr.rollback != "" {
+			rolledBack = append(rolledBack, rr)
+		}
+	}
+	if len(rolledBack) > 0 {
+		b.WriteString("### Rollback\n\n| Resource | Action | Result |\n|---|---|---|\n")
+		for _, rr := range rolledBack {
+			result := "✅"
+			if rr.rollbackErr != "" {
+				result = "❌ " + oneLine(rr.rollbackErr)
+			}
+			name := "`" + rr.name() + "`"
+			if withCluster {
+				name += " (" + rr.cluster + ")"
+			}
+			b.WriteString("| " + strings.Join(escapeCells([]string{name, rr.rollback, result}), " | ") + " |\n")
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+func msOrDash(ms int64, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	return (time.Duration(ms) * time.Millisecond).String()
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+func oneLine(s string) string {
+	return strings.ReplaceAll(s, "\n", "; ")
+}
+
+func escapeCells(cells []string) []string {
+	for i, c := range cells {
+		cells[i] = strings.ReplaceAll(c, "|", "\\|")
+	}
+	return cells
+}
@@ -0,0 +1,65 @@
+package apply
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+func TestReports(t *testing.T) {
+	dir := t.TempDir()
+	junitFile := filepath.Join(dir, "junit.xml")
+	markdownFile := filepath.Join(dir, "report.md")
+
+	rep := newReporter(genericiooptions.NewTestIOStreamsDiscard(), "").withReports(junitFile, markdownFile)
+
+	cm := &ObjectRef{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "cm"}
+	dep := &ObjectRef{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "default", Name: "web"}
+	svc := &ObjectRef{APIVersion: "v1", Kind: "Service", Namespace: "default", Name: "web"}
+
+	rep.emit(&Event{Type: EventPlan, Object: cm, Source: "app.yaml:1 (doc 1)", Action: ActionUpdate})
+	rep.emit(&Event{Type: EventPlan, Object: dep, Source: "app.yaml:8 (doc 2)", Action: ActionCreate})
+	rep.emit(&Event{Type: EventPlan, Object: svc, Source: "app.yaml:30 (doc 3)", Action: ActionCreate})
+	rep.emit(&Event{Type: EventApplied, Object: cm, Action: ActionUpdate, DurationMS: 10})
+	rep.emit(&Event{Type: EventApplied, Object: dep, Action: ActionCreate, DurationMS: 20})
+	rep.emit(&Event{Type: EventApplied, Object: svc, Action: ActionCreate, DurationMS: 5})
+	rep.emit(&Event{Type: EventStatus, Object: cm, Status: "Current", DurationMS: 100})
+	rep.emit(&Event{Type: EventStatus, Object: svc, Status: "Current", DurationMS: 100})
+	rep.emit(&Event{Type: EventStatus, Object: dep, Status: "InProgress", Message: "Available: 0/1", DurationMS: 100})
+	rep.emit(&Event{Type: EventRollback, Object: cm, Action: ActionRestore})
+	rep.emit(&Event{Type: EventRollback, Object: dep, Action: ActionDelete})
+	rep.emit(&Event{Type: EventRollback, Object: svc, Action: ActionDelete, Error: "rollback Service/web: forbidden"})
+
+	plan := []applyItem{{applied: true}, {applied: true}, {applied: true}}
+	rep.result([]*cluster{{plan: plan}}, errors.New("resource not ready: Deployment/web (InProgress)"), true)
+
+	junit, err := os.ReadFile(junitFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(junit), `<testsuites name="katomik" tests="3" failures="1" skipped="0"`)
+	assert.Contains(t, string(junit), `<testcase classname="apps/v1.Deployment" name="Deployment/default/web" file="app.yaml:8 (doc 2)" time="0.120">`)
+	assert.Contains(t, string(junit), `<failure message="InProgress: Available: 0/1" type="readiness">`)
+
+	markdown, err := os.ReadFile(markdownFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(markdown), "## ❌ katomik apply failed and was rolled back")
+	assert.Contains(t, string(markdown), "Applied: 3")
+	assert.Contains(t, string(markdown), "| `ConfigMap/default/cm` | update | app.yaml:1 (doc 1) | Current | 10ms | 100ms |")
+	assert.Contains(t, string(markdown), "| `Deployment/default/web` | create | app.yaml:8 (doc 2) | ❌ InProgress: Available: 0/1 | 20ms | - |")
+	assert.Contains(t, string(markdown), "| `Service/default/web` | delete | ❌ rollback Service/web: forbidden |")
+}
+
+func TestReports_FailureWithoutObjects(t *testing.T) {
+	junitFile := filepath.Join(t.TempDir(), "junit.xml")
+	rep := newReporter(genericiooptions.NewTestIOStreamsDiscard(), "").withReports(junitFile, "")
+	rep.result(nil, errors.New("timed out waiting for lock"), false)
+
+	junit, err := os.ReadFile(junitFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(junit), `<testcase classname="katomik" name="apply"`)
+	assert.Contains(t, string(junit), `<failure message="timed out waiting for lock" type="run">`)
+}
@@ -0,0 +1,289 @@
+package apply
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+// AnnotationRestartedAt is set on the pod template of workloads using a
+// ConfigMap or Secret whose content the run changes, so their pods are
+// replaced and pick the new content up (like kubectl rollout restart).
+const AnnotationRestartedAt = "katomik.io/restarted-at"
+
+// workloads are the kinds restarted on config changes, in lookup order.
+var workloads = []schema.GroupVersionResource{
+	{Group: "apps", Version: "v1", Resource: "deployments"},
+	{Group: "apps", Version: "v1", Resource: "statefulsets"},
+	{Group: "apps", Version: "v1", Resource: "daemonsets"},
+}
+
+var workloadKinds = map[schema.GroupKind]bool{
+	{Group: "apps", Kind: "Deployment"}:  true,
+	{Group: "apps", Kind: "StatefulSet"}: true,
+	{Group: "apps", Kind: "DaemonSet"}:   true,
+}
+
+var (
+	configMapKind = schema.GroupKind{Kind: "ConfigMap"}
+	secretKind    = schema.GroupKind{Kind: "Secret"}
+)
+
+// planRestarts makes the workloads using a ConfigMap or Secret changed by
+// the plan of c roll out, as part of the transaction:
+//
+//   - workloads in the manifests get AnnotationRestartedAt set to now on
+//     their pod template
+//   - workloads only in the cluster (in the namespaces of the changed
+//     configs) are appended to the plan with a patch setting it, backed up
+//     like every other object
+//
+// Rolling back restores the pod templates, so the pods roll back to the old
+// content too. Workloads in the manifests that use no changed config keep
+// the annotation value of the live object, applying them again does not
+// restart them.
+func planRestarts(ctx context.Context, c *cluster, now time.Time) error {
+	changed, err := changedConfigs(c.plan)
+	if err != nil {
+		return err
+	}
+	stamp := now.UTC().Format(time.RFC3339)
+
+	planned := make(map[object.ObjMetadata]bool, len(c.plan))
+	for i := range c.plan {
+		it := &c.plan[i]
+		id, err := object.RuntimeToObjMeta(it.obj)
+		if err != nil {
+			return sourceError(it.src, err)
+		}
+		planned[id] = true
+		if !workloadKinds[id.GroupKind] || !it.existed {
+			continue
+		}
+
+		uses, err := usedConfigs(it.obj, changed)
+		if err != nil {
+			return sourceError(it.src, err)
+		}
+		if len(uses) > 0 {
+			setRestartedAt(it.obj, stamp)
+			it.restart = uses
+			c.rep.Printf("+ restarting %s: uses changed %s\n", it, strings.Join(uses, ", "))
+			continue
+		}
+		if err := keepRestartedAt(it); err != nil {
+			return sourceError(it.src, err)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	var namespaces []string
+	seen := make(map[string]bool)
+	for id := range changed {
+		if !seen[id.Namespace] {
+			seen[id.Namespace] = true
+			namespaces = append(namespaces, id.Namespace)
+		}
+	}
+	sort.Strings(namespaces)
+
+	for _, ns := range namespaces {
+		for _, gvr := range workloads {
+			dr := c.dyn.Resource(gvr).Namespace(ns)
+			list, err := dr.List(ctx, metav1.ListOptions{})
+			if err != nil {
+				c.rep.Printf("! cannot list %s in %s, not restarting them: %v\n", gvr.Resource, ns, err)
+				slog.Warn("cannot list workloads", "resource", gvr.Resource, "namespace", ns, "error", err)
+				continue
+			}
+			for i := range list.Items {
+				live := &list.Items[i]
+				id, err := object.RuntimeToObjMeta(live)
+				if err != nil || planned[id] {
+					continue
+				}
+				uses, err := usedConfigs(live, changed)
+				if err != nil {
+					return fmt.Errorf("%s/%s: %w", live.GetKind(), live.GetName(), err)
+				}
+				if len(uses) == 0 {
+					continue
+				}
+
+				it := applyItem{obj: restartPatch(live, stamp), dr: dr, restart: uses}
+				if err := it.snapshot(live); err != nil {
+					return err
+				}
+				planned[id] = true
+				c.plan = append(c.plan, it)
+				c.rep.Printf("+ restarting %s: uses changed %s\n", &it, strings.Join(uses, ", "))
+				slog.Debug("planned restart", "object", it.String(), "uses", uses)
+			}
+		}
+	}
+	return nil
+}
+
+// changedConfigs returns the existing ConfigMaps and Secrets of plan whose
+// content differs from their backup.
+func changedConfigs(plan []applyItem) (map[object.ObjMetadata]bool, error) {
+	changed := make(map[object.ObjMetadata]bool)
+	for i := range plan {
+		it := &plan[i]
+		gk := it.obj.GroupVersionKind().GroupKind()
+		if (gk != configMapKind && gk != secretKind) || !it.existed {
+			continue
+		}
+		backup := &unstructured.Unstructured{}
+		if err := backup.UnmarshalJSON(it.backup); err != nil {
+			return nil, sourceError(it.src, err)
+		}
+		if !reflect.DeepEqual(configContent(backup), configContent(it.obj)) {
+			changed[object.ObjMetadata{GroupKind: gk, Namespace: it.obj.GetNamespace(), Name: it.obj.GetName()}] = true
+		}
+	}
+	return changed, nil
+}
+
+// configContent returns the data of a ConfigMap or Secret in a comparable
+// form. The stringData of a Secret is folded into its data, the way the
+// apiserver stores it.
+func configContent(u *unstructured.Unstructured) map[string]interface{} {
+	data, _, _ := unstructured.NestedMap(u.Object, "data")
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	stringData, _, _ := unstructured.NestedStringMap(u.Object, "stringData")
+	for k, v := range stringData {
+		data[k] = base64.StdEncoding.EncodeToString([]byte(v))
+	}
+	binaryData, _, _ := unstructured.NestedMap(u.Object, "binaryData")
+	return map[string]interface{}{"data": data, "binaryData": binaryData}
+}
+
+// usedConfigs returns which of the configs in changed the pod template of
+// workload u uses, as sorted "Kind/name" strings. Volumes (projected ones
+// included), env and envFrom of every container are looked at.
+func usedConfigs(u *unstructured.Unstructured, changed map[object.ObjMetadata]bool) ([]string, error) {
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	raw, found, err := unstructured.NestedMap(u.Object, "spec", "template", "spec")
+	if err != nil || !found {
+		return nil, err
+	}
+	var spec corev1.PodSpec
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &spec); err != nil {
+		return nil, fmt.Errorf("invalid pod template: %w", err)
+	}
+
+	uses := make(map[string]bool)
+	ref := func(gk schema.GroupKind, name string) {
+		id := object.ObjMetadata{GroupKind: gk, Namespace: u.GetNamespace(), Name: name}
+		if name != "" && changed[id] {
+			uses[gk.Kind+"/"+name] = true
+		}
+	}
+	for _, v := range spec.Volumes {
+		if v.ConfigMap != nil {
+			ref(configMapKind, v.ConfigMap.Name)
+		}
+		if v.Secret != nil {
+			ref(secretKind, v.Secret.SecretName)
+		}
+		if v.Projected != nil {
+			for _, s := range v.Projected.Sources {
+				if s.ConfigMap != nil {
+					ref(configMapKind, s.ConfigMap.Name)
+				}
+				if s.Secret != nil {
+					ref(secretKind, s.Secret.Name)
+				}
+			}
+		}
+	}
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, ctr := range containers {
+		for _, e := range ctr.EnvFrom {
+			if e.ConfigMapRef != nil {
+				ref(configMapKind, e.ConfigMapRef.Name)
+			}
+			if e.SecretRef != nil {
+				ref(secretKind, e.SecretRef.Name)
+			}
+		}
+		for _, e := range ctr.Env {
+			if e.ValueFrom == nil {
+				continue
+			}
+			if e.ValueFrom.ConfigMapKeyRef != nil {
+				ref(configMapKind, e.ValueFrom.ConfigMapKeyRef.Name)
+			}
+			if e.ValueFrom.SecretKeyRef != nil {
+				ref(secretKind, e.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(uses))
+	for n := range uses {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// setRestartedAt sets AnnotationRestartedAt on the pod template of u.
+func setRestartedAt(u *unstructured.Unstructured, stamp string) {
+	annotations, _, _ := unstructured.NestedStringMap(u.Object, "spec", "template", "metadata", "annotations")
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[AnnotationRestartedAt] = stamp
+	_ = unstructured.SetNestedStringMap(u.Object, annotations, "spec", "template", "metadata", "annotations")
+}
+
+// keepRestartedAt copies AnnotationRestartedAt from the backup of it to the
+// object to apply unless that sets it, so a previous restart is not undone
+// (which would restart the workload once more).
+func keepRestartedAt(it *applyItem) error {
+	if _, found, _ := unstructured.NestedString(it.obj.Object, "spec", "template", "metadata", "annotations", AnnotationRestartedAt); found {
+		return nil
+	}
+	var backup map[string]interface{}
+	if err := json.Unmarshal(it.backup, &backup); err != nil {
+		return err
+	}
+	stamp, found, _ := unstructured.NestedString(backup, "spec", "template", "metadata", "annotations", AnnotationRestartedAt)
+	if found {
+		setRestartedAt(it.obj, stamp)
+	}
+	return nil
+}
+
+// restartPatch returns the server-side apply patch setting
+// AnnotationRestartedAt on the pod template of the live workload.
+func restartPatch(live *unstructured.Unstructured, stamp string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(live.GetAPIVersion())
+	u.SetKind(live.GetKind())
+	u.SetNamespace(live.GetNamespace())
+	u.SetName(live.GetName())
+	setRestartedAt(u, stamp)
+	return u
+}
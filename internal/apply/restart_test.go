@@ -0,0 +1,153 @@
+package apply
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+func testDeployment(name string, podSpec map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("apps/v1")
+	u.SetKind("Deployment")
+	u.SetNamespace("default")
+	u.SetName(name)
+	_ = unstructured.SetNestedMap(u.Object, podSpec, "spec", "template", "spec")
+	return u
+}
+
+func envFromConfigMap(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"containers": []interface{}{map[string]interface{}{
+			"name":    "app",
+			"image":   "app:1",
+			"envFrom": []interface{}{map[string]interface{}{"configMapRef": map[string]interface{}{"name": name}}},
+		}},
+	}
+}
+
+func restartedAt(u *unstructured.Unstructured) string {
+	s, _, _ := unstructured.NestedString(u.Object, "spec", "template", "metadata", "annotations", AnnotationRestartedAt)
+	return s
+}
+
+func TestUsedConfigs(t *testing.T) {
+	changed := map[object.ObjMetadata]bool{
+		{GroupKind: configMapKind, Namespace: "default", Name: "env"}:       true,
+		{GroupKind: configMapKind, Namespace: "default", Name: "projected"}: true,
+		{GroupKind: secretKind, Namespace: "default", Name: "creds"}:        true,
+		{GroupKind: secretKind, Namespace: "other", Name: "tls"}:            true,
+	}
+	u := testDeployment("app", map[string]interface{}{
+		"volumes": []interface{}{
+			map[string]interface{}{"name": "tls", "secret": map[string]interface{}{"secretName": "tls"}},
+			map[string]interface{}{"name": "p", "projected": map[string]interface{}{"sources": []interface{}{
+				map[string]interface{}{"configMap": map[string]interface{}{"name": "projected"}},
+			}}},
+		},
+		"initContainers": []interface{}{map[string]interface{}{
+			"name": "init",
+			"env": []interface{}{map[string]interface{}{
+				"name":      "PASSWORD",
+				"valueFrom": map[string]interface{}{"secretKeyRef": map[string]interface{}{"name": "creds", "key": "password"}},
+			}},
+		}},
+		"containers": envFromConfigMap("env")["containers"],
+	})
+
+	uses, err := usedConfigs(u, changed)
+	require.NoError(t, err)
+	// the Secret tls is changed in another namespace only
+	assert.Equal(t, []string{"ConfigMap/env", "ConfigMap/projected", "Secret/creds"}, uses)
+}
+
+func TestChangedConfigs(t *testing.T) {
+	secret := func(data, stringData map[string]interface{}) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{"data": data}}
+		if stringData != nil {
+			u.Object["stringData"] = stringData
+		}
+		u.SetAPIVersion("v1")
+		u.SetKind("Secret")
+		u.SetNamespace("default")
+		u.SetName("s")
+		return u
+	}
+	item := func(live, desired *unstructured.Unstructured) applyItem {
+		it := applyItem{obj: desired}
+		require.NoError(t, it.snapshot(live))
+		return it
+	}
+
+	live := secret(map[string]interface{}{"k": "dg=="}, nil) // "v"
+	changed, err := changedConfigs([]applyItem{
+		item(testConfigMap("v1"), testConfigMap("v2")),
+		// stringData with the stored value is no change
+		item(live, secret(nil, map[string]interface{}{"k": "v"})),
+		// not existing before, nothing can use the old content
+		{obj: testConfigMap("v3")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[object.ObjMetadata]bool{
+		{GroupKind: configMapKind, Namespace: "default", Name: "cm"}: true,
+	}, changed)
+}
+
+func TestPlanRestarts(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+
+	inCluster := testDeployment("in-cluster", envFromConfigMap("cm"))
+	unrelated := testDeployment("unrelated", envFromConfigMap("other"))
+	dyn := dynamicfake.NewSimpleDynamicClient(scheme, inCluster, unrelated)
+
+	manifest := testDeployment("manifest", envFromConfigMap("cm"))
+	manifestLive := manifest.DeepCopy()
+	setRestartedAt(manifestLive, "2020-01-01T00:00:00Z")
+	untouched := testDeployment("untouched", envFromConfigMap("other"))
+	untouchedLive := untouched.DeepCopy()
+	setRestartedAt(untouchedLive, "2020-01-01T00:00:00Z")
+
+	streams, _, out, _ := genericiooptions.NewTestIOStreams()
+	c := &cluster{dyn: dyn, rep: newReporter(streams, "")}
+	for _, p := range []struct{ live, desired *unstructured.Unstructured }{
+		{testConfigMap("v1"), testConfigMap("v2")},
+		{manifestLive, manifest},
+		{untouchedLive, untouched},
+	} {
+		it := applyItem{obj: p.desired}
+		require.NoError(t, it.snapshot(p.live))
+		c.plan = append(c.plan, it)
+	}
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, planRestarts(context.Background(), c, now))
+
+	require.Len(t, c.plan, 4)
+	assert.Equal(t, "2026-01-02T03:04:05Z", restartedAt(c.plan[1].obj))
+	assert.Equal(t, []string{"ConfigMap/cm"}, c.plan[1].restart)
+	assert.Equal(t, "2020-01-01T00:00:00Z", restartedAt(c.plan[2].obj), "previous restart must be kept")
+	assert.Empty(t, c.plan[2].restart)
+
+	it := c.plan[3]
+	assert.Equal(t, "in-cluster", it.obj.GetName())
+	assert.Equal(t, "2026-01-02T03:04:05Z", restartedAt(it.obj))
+	assert.True(t, it.existed)
+	_, found, _ := unstructured.NestedSlice(it.obj.Object, "spec", "template", "spec", "containers")
+	assert.False(t, found, "cluster workloads are patched with the annotation only")
+
+	live, err := it.dr.Get(context.Background(), "in-cluster", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, restartedAt(live), "planning must not change the cluster")
+	assert.Contains(t, out.String(), "+ restarting Deployment/in-cluster: uses changed ConfigMap/cm")
+}
@@ -0,0 +1,77 @@
+package apply
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/clusterreader"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/collector"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/engine"
+	pollEvent "sigs.k8s.io/cli-utils/pkg/kstatus/polling/event"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/statusreaders"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/watcher"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+// DefaultPollInterval is how often resources are polled when watching is
+// disabled or forbidden.
+const DefaultPollInterval = 2 * time.Second
+
+// statusEvents starts tracking the status of ids in cluster c until ctx is
+// done. With watch, one informer per kind and namespace reports changes as
+// they happen (namespace scope, so no cluster-wide list permission is
+// needed); otherwise every object is fetched on its own each interval, which
+// needs nothing but get permission. custom computes
+// the status of the kinds it supports, the built-in readers do the rest.
+func statusEvents(
+	ctx context.Context,
+	c *cluster,
+	ids []object.ObjMetadata,
+	custom engine.StatusReader,
+	watch bool,
+	interval time.Duration,
+) <-chan pollEvent.Event {
+	if watch {
+		slog.Debug("watching status", "cluster", c.String(), "resources", len(ids))
+		w := watcher.NewDefaultStatusWatcher(c.dyn, c.mapper)
+		w.StatusReader = statusreaders.NewStatusReader(c.mapper, custom)
+		return w.Watch(ctx, ids, watcher.Options{RESTScopeStrategy: watcher.RESTScopeNamespace})
+	}
+
+	slog.Debug("polling status", "cluster", c.String(), "resources", len(ids), "interval", interval)
+	poller := polling.NewStatusPoller(c.reader, c.mapper, polling.Options{
+		CustomStatusReaders:  []engine.StatusReader{custom},
+		ClusterReaderFactory: engine.ClusterReaderFactoryFunc(clusterreader.NewDirectClusterReader),
+	})
+	return poller.Poll(ctx, ids, polling.PollOptions{PollInterval: interval})
+}
+
+// collectStatus tracks ids with statusEvents until ctx is done and returns
+// the collected statuses; observer sees every event and usually cancels ctx
+// once the statuses it waits for are reached. If watching is forbidden the
+// objects are polled every opts.pollInterval instead.
+func collectStatus(
+	ctx context.Context,
+	c *cluster,
+	ids []object.ObjMetadata,
+	custom engine.StatusReader,
+	opts *waitOptions,
+	observer collector.ObserverFunc,
+) *collector.ResourceStatusCollector {
+	watch := opts.watch
+	for {
+		statusCollector := collector.NewResourceStatusCollector(ids)
+		done := statusCollector.ListenWithObserver(statusEvents(ctx, c, ids, custom, watch, opts.pollInterval), observer)
+		<-done
+		if watch && apierrors.IsForbidden(statusCollector.Error) {
+			c.rep.Printf("! watching is forbidden, polling every %s instead\n", opts.pollInterval)
+			slog.Warn("watch forbidden, falling back to polling", "error", statusCollector.Error)
+			watch = false
+			continue
+		}
+		return statusCollector
+	}
+}
@@ -0,0 +1,90 @@
+package apply
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashmap-kz/katomik/internal/readiness"
+	"github.com/hashmap-kz/katomik/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/discovery/cached/memory"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/restmapper"
+	clienttesting "k8s.io/client-go/testing"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// statusTestCluster returns a cluster backed by fakes holding the ConfigMap
+// "cm", planned for readiness tracking.
+func statusTestCluster(t *testing.T) (*cluster, *dynamicfake.FakeDynamicClient, *genericiooptions.IOStreams) {
+	t.Helper()
+	// the fake dynamic client cannot stream initial events, informers have
+	// to list first
+	t.Setenv("KUBE_FEATURE_WatchListClient", "false")
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+
+	cm := testConfigMap("v1")
+	dyn := dynamicfake.NewSimpleDynamicClient(scheme, cm.DeepCopy())
+	reader := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(cm.DeepCopy()).Build()
+
+	disc := kubefake.NewClientset().Discovery().(*fakediscovery.FakeDiscovery)
+	disc.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: metav1.Verbs{"get", "list", "watch"}},
+			{Name: "secrets", Kind: "Secret", Namespaced: true, Verbs: metav1.Verbs{"get", "list", "watch"}},
+		},
+	}}
+
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	c := &cluster{
+		dyn:    dyn,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disc)),
+		reader: reader,
+		rep:    newReporter(streams, ""),
+		plan:   []applyItem{{obj: cm, src: utils.Source{File: "cm.yaml"}}},
+	}
+	return c, dyn, &streams
+}
+
+func testWaitOptions() *waitOptions {
+	return &waitOptions{
+		rules:        &readiness.Rules{},
+		timeout:      10 * time.Second,
+		start:        time.Now(),
+		watch:        true,
+		pollInterval: 10 * time.Millisecond,
+	}
+}
+
+func TestWaitStatus_Watch(t *testing.T) {
+	c, _, streams := statusTestCluster(t)
+
+	require.NoError(t, waitStatus(context.Background(), c, testWaitOptions()))
+	out := streams.Out.(interface{ String() string }).String()
+	assert.Contains(t, out, "1/1 Current")
+	assert.NotContains(t, out, "forbidden")
+}
+
+func TestWaitStatus_ForbiddenWatchFallsBackToPolling(t *testing.T) {
+	c, dyn, streams := statusTestCluster(t)
+	dyn.PrependReactor("list", "configmaps", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(configMapGVR.GroupResource(), "", nil)
+	})
+
+	require.NoError(t, waitStatus(context.Background(), c, testWaitOptions()))
+	out := streams.Out.(interface{ String() string }).String()
+	assert.Contains(t, out, "watching is forbidden, polling every 10ms instead")
+	assert.Contains(t, out, "1/1 Current")
+}
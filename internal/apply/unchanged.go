@@ -0,0 +1,71 @@
+package apply
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+)
+
+// fieldManager is the server-side apply field manager of katomik.
+const fieldManager = "atomic-apply"
+
+// planUnchanged marks the existing objects in the plan of c that applying
+// would not change: the result of a server-side dry-run apply equals the
+// backup and fieldManager would own the same fields as before. Unchanged
+// objects are neither applied nor waited for nor rolled back, so a run does
+// not bump their resourceVersion.
+//
+// The backup leaves managedFields out, so the ownership is compared on its
+// own: an apply taking fields over from another manager (Force) or owning
+// an object for the first time changes the object even if its content
+// stays the same.
+//
+// A failing dry-run (e.g. a webhook without dry-run support) only means the
+// object cannot be classified, it is applied as planned.
+func planUnchanged(ctx context.Context, c *cluster) {
+	for i := range c.plan {
+		it := &c.plan[i]
+		if !it.existed || len(it.restart) > 0 {
+			continue
+		}
+		objJSON, err := json.Marshal(it.obj)
+		if err != nil {
+			continue
+		}
+		dry, err := it.dr.Patch(ctx, it.obj.GetName(), types.ApplyPatchType, objJSON, metav1.PatchOptions{
+			FieldManager: fieldManager,
+			Force:        ptr.To(true),
+			DryRun:       []string{metav1.DryRunAll},
+		})
+		if err != nil {
+			logAPIError("dry-run apply failed, applying as planned", it, err)
+			continue
+		}
+		snap := applyItem{}
+		if err := snap.snapshot(dry); err != nil {
+			continue
+		}
+		if bytes.Equal(snap.backup, it.backup) && bytes.Equal(managedFields(dry), it.managed) {
+			it.unchanged = true
+			c.rep.Printf("= unchanged %s\n", it)
+			slog.Debug("unchanged", "object", it.String())
+		}
+	}
+}
+
+// managedFields returns the fields of u owned by the server-side apply of
+// fieldManager, nil if it owns none.
+func managedFields(u *unstructured.Unstructured) []byte {
+	for _, e := range u.GetManagedFields() {
+		if e.Manager == fieldManager && e.Operation == metav1.ManagedFieldsOperationApply && e.FieldsV1 != nil {
+			return e.FieldsV1.Raw
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestPlanUnchanged(t *testing.T) {
+	owned := func(manager string) []metav1.ManagedFieldsEntry {
+		return []metav1.ManagedFieldsEntry{{
+			Manager:   manager,
+			Operation: metav1.ManagedFieldsOperationApply,
+			FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:data":{"f:key":{}}}`)},
+		}}
+	}
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	// like a dry-run apply: the patched object is returned, nothing is stored
+	dyn.PrependReactor("patch", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patch := action.(clienttesting.PatchActionImpl)
+		assert.Equal(t, []string{metav1.DryRunAll}, patch.PatchOptions.DryRun)
+		if patch.Name == "broken" {
+			return true, nil, apierrors.NewBadRequest("dry-run not supported")
+		}
+		u := &unstructured.Unstructured{}
+		require.NoError(t, u.UnmarshalJSON(patch.Patch))
+		u.SetResourceVersion("2")
+		u.SetManagedFields(owned(fieldManager))
+		return true, u, nil
+	})
+	dr := dyn.Resource(configMapGVR).Namespace("default")
+
+	item := func(name, live, desired, manager string) applyItem {
+		it := applyItem{obj: testConfigMap(desired), dr: dr}
+		it.obj.SetName(name)
+		if live != "" {
+			cur := testConfigMap(live)
+			cur.SetName(name)
+			cur.SetResourceVersion("1")
+			cur.SetManagedFields(owned(manager))
+			require.NoError(t, it.snapshot(cur))
+		}
+		return it
+	}
+	streams, _, out, _ := genericiooptions.NewTestIOStreams()
+	c := &cluster{rep: newReporter(streams, ""), plan: []applyItem{
+		item("same", "v1", "v1", fieldManager),
+		item("changed", "v1", "v2", fieldManager),
+		item("created", "", "v1", ""),
+		item("broken", "v1", "v1", fieldManager),
+		item("taken-over", "v1", "v1", "kubectl"),
+	}}
+
+	planUnchanged(context.Background(), c)
+	assert.True(t, c.plan[0].unchanged)
+	assert.Equal(t, ActionUnchanged, c.plan[0].action())
+	assert.False(t, c.plan[1].unchanged)
+	assert.False(t, c.plan[2].unchanged)
+	assert.False(t, c.plan[3].unchanged, "objects that cannot be dry-run are applied")
+	assert.False(t, c.plan[4].unchanged, "taking over the fields of another manager changes the object")
+	assert.Equal(t, "= unchanged ConfigMap/same\n", out.String())
+
+	// unchanged objects are neither applied nor rolled back
+	c.plan = c.plan[:1]
+	require.NoError(t, applyPlanned(context.Background(), c.rep, c.plan, DriftAbort))
+	assert.False(t, c.plan[0].applied)
+	require.NoError(t, rollbackPlan(context.Background(), c, ""))
+	assert.Empty(t, c.plan[0].undone)
+}
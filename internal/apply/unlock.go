@@ -0,0 +1,45 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashmap-kz/katomik/internal/lock"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RunUnlock deletes the release Lease of ApplyOpts (Release, LockNamespace,
+// defaulting to the target namespace) regardless of its holder. It is meant
+// for stale locks left behind by killed runs.
+//
+// Errors carry ExitInput for an invalid kubeconfig or a missing Lease and
+// ExitLocked if the Lease could not be removed.
+func RunUnlock(ctx context.Context, runOpts *AtomicApplyRunOptions) error {
+	rep := newReporter(runOpts.Streams, "").withQuiet(runOpts.ApplyOpts.Quiet)
+	namespace := runOpts.ApplyOpts.LockNamespace
+	if namespace == "" {
+		namespace = targetNamespace(runOpts)
+	}
+	name := lock.LeaseName(runOpts.ApplyOpts.Release)
+
+	cfg, err := runOpts.ConfigFlags.ToRESTConfig()
+	if err != nil {
+		return withExitCode(ExitInput, err)
+	}
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return withExitCode(ExitInput, err)
+	}
+
+	holder, err := lock.Unlock(ctx, client, namespace, name)
+	if apierrors.IsNotFound(err) {
+		return withExitCode(ExitInput, fmt.Errorf("no lock %s/%s: %w", namespace, name, err))
+	}
+	if err != nil {
+		return withExitCode(ExitLocked, fmt.Errorf("cannot remove lock %s/%s: %w", namespace, name, err))
+	}
+	rep.Printf("✓ lock %s/%s removed (held by %s)\n", namespace, name, holder)
+	return nil
+}
@@ -0,0 +1,125 @@
+package apply
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashmap-kz/katomik/internal/utils"
+	"github.com/hashmap-kz/katomik/internal/validate"
+	"k8s.io/client-go/discovery"
+)
+
+// RunValidate decodes the manifests and checks them against OpenAPI schemas
+// without changing anything in the cluster.
+//
+// Schemas are taken from ApplyOpts.SchemaDirs, from CRDs found in the manifest
+// set and - unless runOpts.ConfigFlags is nil (offline mode) - from the
+// cluster's /openapi/v3 endpoint.
+func RunValidate(ctx context.Context, runOpts *AtomicApplyRunOptions) error {
+	rep := newReporter(runOpts.Streams, "").withQuiet(runOpts.ApplyOpts.Quiet)
+
+	docs, err := readDocs(ctx, runOpts)
+	if err != nil {
+		return withExitCode(ExitInput, err)
+	}
+	docs, filtered, err := filterDocs(docs, &runOpts.ApplyOpts)
+	if err != nil {
+		return withExitCode(ExitInput, err)
+	}
+	printFiltered(rep, filtered)
+	if _, err := loadReadinessRules(&runOpts.ApplyOpts, docs); err != nil {
+		return withExitCode(ExitInput, err)
+	}
+
+	var disc discovery.DiscoveryInterface
+	if runOpts.ConfigFlags != nil {
+		disc, err = runOpts.ConfigFlags.ToDiscoveryClient()
+		if err != nil {
+			return withExitCode(ExitInput, err)
+		}
+	}
+
+	v, err := newValidator(runOpts, docs, disc)
+	if err != nil {
+		return withExitCode(ExitInput, err)
+	}
+	checked, err := validateDocs(rep, v, docs, true)
+	if err != nil {
+		return withExitCode(ExitInput, err)
+	}
+
+	if skipped := len(docs) - checked; skipped > 0 {
+		rep.Printf("✓ %d object(s) valid, %d without schema\n", checked, skipped)
+	} else {
+		rep.Printf("✓ %d object(s) valid\n", checked)
+	}
+	return nil
+}
+
+// newValidator collects schemas from the configured schema directories, the
+// CRDs of the manifest set and, when disc is not nil, from the cluster.
+func newValidator(
+	runOpts *AtomicApplyRunOptions,
+	docs []utils.Document,
+	disc discovery.DiscoveryInterface,
+) (*validate.Validator, error) {
+	v := validate.New()
+
+	// CRDs from the manifest set describe the CRs that will be applied with them
+	for _, d := range docs {
+		if utils.IsCRD(d.Object) {
+			if err := v.AddCRD(d.Object); err != nil {
+				return nil, fmt.Errorf("%s: %w", d.Source, err)
+			}
+		}
+	}
+	for _, dir := range runOpts.ApplyOpts.SchemaDirs {
+		if err := v.LoadDir(dir); err != nil {
+			return nil, fmt.Errorf("loading schemas: %w", err)
+		}
+	}
+	if disc != nil {
+		v.UseCluster(disc.OpenAPIV3())
+	}
+	return v, nil
+}
+
+// validateDocs validates every document and prints one line per violation,
+// prefixed with the document source. Objects without a known schema are
+// reported only when reportMissing is set. It returns how many objects had a
+// schema to be checked against.
+func validateDocs(rep *reporter, v *validate.Validator, docs []utils.Document, reportMissing bool) (int, error) {
+	var checked, invalid, violations int
+
+	for _, d := range docs {
+		kn := fmt.Sprintf("%s/%s", d.Object.GetKind(), d.Object.GetName())
+
+		errs, err := v.Validate(d.Object)
+		if err != nil {
+			if !errors.Is(err, validate.ErrNoSchema) {
+				return checked, err
+			}
+			if reportMissing {
+				rep.Printf("? %s %s: %v\n", d.Source, kn, err)
+			}
+			continue
+		}
+		checked++
+		if len(errs) == 0 {
+			continue
+		}
+
+		invalid++
+		violations += len(errs)
+		for _, e := range errs {
+			rep.Printf("✗ %s %s: %v\n", d.Source, kn, e)
+			rep.emit(&Event{Type: EventInvalid, Object: docRef(d), Source: d.Source.String(), Error: e.Error()})
+		}
+	}
+
+	if invalid > 0 {
+		return checked, fmt.Errorf("validation failed: %d error(s) in %d object(s)", violations, invalid)
+	}
+	return checked, nil
+}
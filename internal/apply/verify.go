@@ -0,0 +1,243 @@
+package apply
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashmap-kz/katomik/internal/readiness"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/collector"
+	pollEvent "sigs.k8s.io/cli-utils/pkg/kstatus/polling/event"
+	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+// verifyRollback checks that the rollback of c converged: deleted objects
+// are gone (finalizers may keep them terminating for a while) and restored
+// objects are Current again. Where the live state of a restored object
+// differs from its backup a warning is reported, nothing fails.
+//
+// It waits at most opts.wait.timeout, within ctx. Objects annotated with
+// katomik.io/wait: "false" in the backup are only compared, not waited for.
+// Deleted objects still there afterwards are looked at by stuckDeletion.
+// Every problem found is returned, joined.
+func verifyRollback(ctx context.Context, c *cluster, opts *rollbackOptions) error {
+	rep, plan, wait := c.rep, c.plan, opts.wait
+	var (
+		ids     []object.ObjMetadata
+		objs    []*unstructured.Unstructured
+		errs    []error
+		items   = make(map[object.ObjMetadata]*applyItem)
+		backups = make(map[object.ObjMetadata]*unstructured.Unstructured)
+		want    = make(map[object.ObjMetadata]kstatus.Status)
+	)
+	track := func(id object.ObjMetadata, it *applyItem, status kstatus.Status) {
+		ids = append(ids, id)
+		items[id] = it
+		want[id] = status
+	}
+	for i := range plan {
+		it := &plan[i]
+		if it.undone == "" {
+			continue
+		}
+		id, err := object.RuntimeToObjMeta(it.obj)
+		if err != nil {
+			errs = append(errs, sourceError(it.src, err))
+			continue
+		}
+		if it.undone == ActionDelete {
+			track(id, it, kstatus.NotFoundStatus)
+			continue
+		}
+
+		u := &unstructured.Unstructured{}
+		if err := u.UnmarshalJSON(it.backup); err != nil {
+			errs = append(errs, sourceError(it.src, err))
+			continue
+		}
+		backups[id] = u
+		if waits, _, err := readiness.Wait(u, 0); err == nil && waits {
+			objs = append(objs, u)
+			track(id, it, kstatus.CurrentStatus)
+		}
+	}
+	if len(ids) == 0 && len(backups) == 0 {
+		return errors.Join(errs...)
+	}
+
+	rep.Printf("+ verifying rollback: waiting for %d resource(s) to be deleted or Current\n", len(ids))
+	slog.Info("verifying rollback", "resources", len(ids), "restored", len(backups))
+	cv := &convergence{want: want}
+	got := make(map[object.ObjMetadata]kstatus.Status, len(ids))
+	if len(ids) > 0 {
+		waitCtx, stop := withOptionalTimeout(ctx, wait.timeout)
+		custom := readiness.NewStatusReader(c.mapper, wait.rules, objs)
+		statusCollector := collectStatus(waitCtx, c, ids, custom, wait, cv.observer(stop))
+		stop()
+		if statusCollector.Error != nil {
+			errs = append(errs, statusCollector.Error)
+		}
+		for _, id := range ids {
+			got[id] = cv.status(statusCollector, id)
+		}
+	}
+
+	for _, id := range ids {
+		it := items[id]
+		status := got[id]
+		var err error
+		switch {
+		case status == want[id]:
+		case want[id] == kstatus.NotFoundStatus:
+			if err = stuckDeletion(ctx, rep, it, opts); err == nil {
+				status = kstatus.NotFoundStatus
+			}
+		default:
+			err = fmt.Errorf("restored object not Current: %s/%s (%s)", id.GroupKind.Kind, id.Name, status)
+		}
+		rep.emit(&Event{
+			Type:   EventVerify,
+			Object: it.ref(),
+			Source: it.src.String(),
+			Action: it.undone,
+			Status: status.String(),
+			Error:  errorString(err),
+		})
+		if err != nil {
+			errs = append(errs, sourceError(it.src, err))
+		}
+	}
+
+	// compare the restored objects with their backups, in plan order
+	for i := range plan {
+		it := &plan[i]
+		if it.undone != ActionRestore {
+			continue
+		}
+		id, err := object.RuntimeToObjMeta(it.obj)
+		if err != nil || backups[id] == nil {
+			continue
+		}
+		paths, err := compareRestored(ctx, it, backups[id])
+		if err != nil {
+			rep.emit(&Event{Type: EventVerify, Object: it.ref(), Source: it.src.String(), Action: it.undone, Error: err.Error()})
+			errs = append(errs, sourceError(it.src, err))
+			continue
+		}
+		if len(paths) > 0 {
+			// defaulting, mutating webhooks and controllers (e.g. an HPA
+			// scaling spec.replicas) change restored objects as well, a
+			// divergence is reported but does not fail the rollback
+			msg := fmt.Sprintf("differs from backup: %s", strings.Join(paths, ", "))
+			rep.Printf("! restored %s/%s %s\n", it.obj.GetKind(), it.obj.GetName(), msg)
+			rep.emit(&Event{Type: EventVerify, Object: it.ref(), Source: it.src.String(), Action: it.undone, Message: msg})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	rep.Println("✓ rollback verified")
+	return nil
+}
+
+// convergence tracks whether every resource reached the status it should end
+// up with: NotFound for deleted objects, Current for restored ones.
+//
+// A watch only reports deletions it sees happen, objects that were already
+// gone when it started have no status at all. Once the watch has listed
+// everything (its SyncEvent) a missing status therefore means NotFound. The
+// poller reports NotFound itself.
+type convergence struct {
+	want   map[object.ObjMetadata]kstatus.Status
+	synced bool
+}
+
+// status returns the status of id collected by c.
+func (cv *convergence) status(c *collector.ResourceStatusCollector, id object.ObjMetadata) kstatus.Status {
+	rs := c.ResourceStatuses[id]
+	switch {
+	case rs != nil && rs.Status != kstatus.UnknownStatus:
+		return rs.Status
+	case cv.synced:
+		return kstatus.NotFoundStatus
+	default:
+		return kstatus.UnknownStatus
+	}
+}
+
+// observer cancels the status collection once every resource has converged.
+func (cv *convergence) observer(cancel context.CancelFunc) collector.ObserverFunc {
+	return func(c *collector.ResourceStatusCollector, e pollEvent.Event) {
+		if e.Type == pollEvent.SyncEvent {
+			cv.synced = true
+		}
+		for id, want := range cv.want {
+			if cv.status(c, id) != want {
+				return
+			}
+		}
+		cancel()
+	}
+}
+
+// compareRestored fetches the live object of it and returns the paths of the
+// fields that differ from the backup. Metadata and status are maintained by
+// the API server and controllers and are not compared. A restored object
+// that is gone is an error.
+func compareRestored(ctx context.Context, it *applyItem, backup *unstructured.Unstructured) ([]string, error) {
+	live, err := it.dr.Get(ctx, it.obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("restored object is gone: %s/%s", it.obj.GetKind(), it.obj.GetName())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("verify %s: %w", it, err)
+	}
+	return divergence(backup.Object, live.Object), nil
+}
+
+// divergence returns the sorted paths of the fields in which live differs
+// from backup, leaving out apiVersion, kind, metadata and status. Maps are
+// compared field by field, any other value (lists included) as a whole.
+func divergence(backup, live map[string]interface{}) []string {
+	var paths []string
+	var walk func(prefix string, a, b map[string]interface{})
+	walk = func(prefix string, a, b map[string]interface{}) {
+		keys := make(map[string]bool, len(a)+len(b))
+		for k := range a {
+			keys[k] = true
+		}
+		for k := range b {
+			keys[k] = true
+		}
+		for k := range keys {
+			if prefix == "" && (k == "apiVersion" || k == "kind" || k == "metadata" || k == "status") {
+				continue
+			}
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			am, aok := a[k].(map[string]interface{})
+			bm, bok := b[k].(map[string]interface{})
+			if aok && bok {
+				walk(path, am, bm)
+				continue
+			}
+			if !reflect.DeepEqual(a[k], b[k]) {
+				paths = append(paths, path)
+			}
+		}
+	}
+	walk("", backup, live)
+	sort.Strings(paths)
+	return paths
+}
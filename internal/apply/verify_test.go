@@ -0,0 +1,96 @@
+package apply
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+func TestDivergence(t *testing.T) {
+	backup := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "app", "annotations": map[string]interface{}{"rev": "1"}},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{"image": "app:1"}},
+			}},
+		},
+		"status": map[string]interface{}{"replicas": int64(2)},
+	}
+
+	live := backup
+	assert.Empty(t, divergence(backup, live))
+
+	live = map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "app", "annotations": map[string]interface{}{"rev": "2"}},
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+			"paused":   true,
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{"image": "app:2"}},
+			}},
+		},
+	}
+	assert.Equal(t, []string{"spec.paused", "spec.replicas", "spec.template.spec.containers"}, divergence(backup, live))
+}
+
+// rolledBackCluster returns the test cluster with "cm" snapshotted and
+// marked as undone with action.
+func rolledBackCluster(t *testing.T, action string) (*cluster, *applyItem) {
+	t.Helper()
+	c, dyn, _ := statusTestCluster(t)
+	it := &c.plan[0]
+	it.dr = dyn.Resource(configMapGVR).Namespace("default")
+	cur, err := it.dr.Get(context.Background(), "cm", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NoError(t, it.snapshot(cur))
+	if action == ActionDelete {
+		require.NoError(t, it.snapshot(nil))
+	}
+	it.undone = action
+	return c, it
+}
+
+func TestVerifyRollback_Restored(t *testing.T) {
+	c, _ := rolledBackCluster(t, ActionRestore)
+
+	require.NoError(t, verifyRollback(context.Background(), c, &rollbackOptions{wait: testWaitOptions()}))
+}
+
+func TestVerifyRollback_Diverged(t *testing.T) {
+	c, it := rolledBackCluster(t, ActionRestore)
+	streams, _, out, _ := genericiooptions.NewTestIOStreams()
+	c.rep = newReporter(streams, "")
+	_, err := it.dr.Update(context.Background(), testConfigMap("changed"), metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	// e.g. a webhook or an HPA changed it: reported, the rollback still holds
+	require.NoError(t, verifyRollback(context.Background(), c, &rollbackOptions{wait: testWaitOptions()}))
+	assert.Contains(t, out.String(), "! restored ConfigMap/cm differs from backup: data.key")
+}
+
+func TestVerifyRollback_Deleted(t *testing.T) {
+	c, it := rolledBackCluster(t, ActionDelete)
+	require.NoError(t, it.dr.Delete(context.Background(), "cm", metav1.DeleteOptions{}))
+
+	require.NoError(t, verifyRollback(context.Background(), c, &rollbackOptions{wait: testWaitOptions()}))
+}
+
+func TestVerifyRollback_DeletedStillPresent(t *testing.T) {
+	c, _ := rolledBackCluster(t, ActionDelete)
+	opts := testWaitOptions()
+	opts.timeout = 200 * time.Millisecond
+
+	err := verifyRollback(context.Background(), c, &rollbackOptions{wait: opts})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "deleted object still present: ConfigMap/cm")
+}
@@ -0,0 +1,307 @@
+// Package lock serializes katomik runs with a coordination.k8s.io/v1 Lease.
+//
+// A run acquires the Lease before it plans anything, renews it while the
+// transaction is in progress and releases it at the end. A Lease that has not
+// been renewed within its duration is stale (the holder crashed or was killed)
+// and is taken over by the next run.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// DefaultLeaseDuration is how long a Lease stays valid without renewal.
+	DefaultLeaseDuration = 30 * time.Second
+
+	// DefaultTimeout is how long a run waits for a Lease held by another run.
+	DefaultTimeout = time.Minute
+
+	leasePrefix = "katomik"
+)
+
+// ErrTimeout is returned when the Lease could not be acquired in time.
+var ErrTimeout = errors.New("timed out waiting for lock")
+
+// LeaseName returns the name of the Lease guarding release, or the
+// namespace-wide Lease when release is empty.
+func LeaseName(release string) string {
+	if release == "" {
+		return leasePrefix
+	}
+	return leasePrefix + "-" + release
+}
+
+// Options configure a Lock.
+//
+//	Namespace     - namespace of the Lease
+//	Name          - name of the Lease, see LeaseName
+//	Timeout       - how long Acquire waits for a Lease held by somebody else
+//	LeaseDuration - validity of the Lease, it is renewed every third of it
+//	PollInterval  - how often a held Lease is checked while waiting
+type Options struct {
+	Namespace     string
+	Name          string
+	Timeout       time.Duration
+	LeaseDuration time.Duration
+	PollInterval  time.Duration
+}
+
+// Lock is a Lease acquired by this process.
+type Lock struct {
+	client   kubernetes.Interface
+	opts     Options
+	identity string
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Identity returns the holder identity written into Leases by this process:
+// hostname, pid and a random suffix.
+func Identity() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	b := make([]byte, 4)
+	//nolint:errcheck
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// Acquire takes the Lease described by opts, waiting up to opts.Timeout while
+// another run holds it. Once acquired the Lease is renewed in the background
+// until Release is called; onLost is invoked once the Lease is lost: taken
+// over or deleted (e.g. by 'katomik unlock'), or not renewed in time because
+// renewing kept failing until the Lease expired.
+//
+// waiting is called once with the current holder when Acquire has to wait.
+func Acquire(
+	ctx context.Context,
+	client kubernetes.Interface,
+	opts Options,
+	waiting func(holder string),
+	onLost func(err error),
+) (*Lock, error) {
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = DefaultLeaseDuration
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+
+	l := &Lock{
+		client:   client,
+		opts:     opts,
+		identity: Identity(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	deadline := time.Now().Add(opts.Timeout)
+	notified := false
+	for {
+		holder, err := l.tryAcquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if holder == "" {
+			break
+		}
+		if !notified && waiting != nil {
+			waiting(holder)
+			notified = true
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w %s/%s held by %s", ErrTimeout, opts.Namespace, opts.Name, holder)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(opts.PollInterval):
+		}
+	}
+
+	go l.renew(time.Now(), onLost)
+	return l, nil
+}
+
+// tryAcquire creates or takes over the Lease. It returns the identity of the
+// current holder if the Lease is held by somebody else.
+func (l *Lock) tryAcquire(ctx context.Context) (string, error) {
+	leases := l.client.CoordinationV1().Leases(l.opts.Namespace)
+	now := metav1.NewMicroTime(time.Now())
+
+	lease, err := leases.Get(ctx, l.opts.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      l.opts.Name,
+				Namespace: l.opts.Namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": leasePrefix},
+			},
+			Spec: l.spec(now, now),
+		}
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			// somebody was faster, look at their Lease in the next round
+			return "another run", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("creating lease %s/%s: %w", l.opts.Namespace, l.opts.Name, err)
+		}
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading lease %s/%s: %w", l.opts.Namespace, l.opts.Name, err)
+	}
+
+	holder := ptr.Deref(lease.Spec.HolderIdentity, "")
+	if holder != "" && holder != l.identity && !expired(lease, now.Time) {
+		return holder, nil
+	}
+
+	// free, stale or ours: take it over, the resourceVersion guards against
+	// a concurrent takeover
+	lease.Spec = l.spec(now, now)
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return "another run", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("taking over lease %s/%s: %w", l.opts.Namespace, l.opts.Name, err)
+	}
+	return "", nil
+}
+
+func (l *Lock) spec(acquired, renewed metav1.MicroTime) coordinationv1.LeaseSpec {
+	return coordinationv1.LeaseSpec{
+		HolderIdentity:       ptr.To(l.identity),
+		LeaseDurationSeconds: ptr.To(int32(l.opts.LeaseDuration / time.Second)),
+		AcquireTime:          &acquired,
+		RenewTime:            &renewed,
+	}
+}
+
+// expired reports whether lease was not renewed within its duration.
+func expired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	d := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	return lease.Spec.RenewTime.Add(d).Before(now)
+}
+
+// renew keeps the Lease alive until Release is called. A failed renewal
+// (e.g. a timeout or a conflict) is retried on the next tick as long as the
+// last successful renewal, at renewed, is younger than the lease duration:
+// until then the Lease is still ours. Like the renew deadline of client-go
+// leader election, the Lease is only given up once it is taken over, deleted
+// or expired.
+func (l *Lock) renew(renewed time.Time, onLost func(err error)) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.opts.LeaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			lost, err := l.renewOnce(now)
+			if err == nil {
+				renewed = now
+				continue
+			}
+			if !lost && now.Sub(renewed) < l.opts.LeaseDuration {
+				slog.Warn("cannot renew lock, retrying", "lease", l.opts.Namespace+"/"+l.opts.Name, "error", err)
+				continue
+			}
+			if onLost != nil {
+				onLost(fmt.Errorf("lock %s/%s lost: %w", l.opts.Namespace, l.opts.Name, err))
+			}
+			return
+		}
+	}
+}
+
+// renewOnce renews the Lease; lost tells whether it is gone for good (taken
+// over or deleted) rather than just not renewed this time.
+func (l *Lock) renewOnce(now time.Time) (lost bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.LeaseDuration/3)
+	defer cancel()
+
+	leases := l.client.CoordinationV1().Leases(l.opts.Namespace)
+	lease, err := leases.Get(ctx, l.opts.Name, metav1.GetOptions{})
+	if err != nil {
+		return apierrors.IsNotFound(err), err
+	}
+	if holder := ptr.Deref(lease.Spec.HolderIdentity, ""); holder != l.identity {
+		return true, fmt.Errorf("now held by %q", holder)
+	}
+	lease.Spec.RenewTime = ptr.To(metav1.NewMicroTime(now))
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// Release stops renewing and frees the Lease if it is still held by this
+// process. It is safe to call more than once.
+func (l *Lock) Release(ctx context.Context) error {
+	var err error
+	l.stopOnce.Do(func() {
+		close(l.stop)
+		<-l.done
+
+		leases := l.client.CoordinationV1().Leases(l.opts.Namespace)
+		var lease *coordinationv1.Lease
+		lease, err = leases.Get(ctx, l.opts.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			err = nil
+			return
+		}
+		if err != nil || ptr.Deref(lease.Spec.HolderIdentity, "") != l.identity {
+			return
+		}
+		err = leases.Delete(ctx, l.opts.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+		})
+		if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+			err = nil
+		}
+	})
+	return err
+}
+
+// Unlock deletes the Lease regardless of its holder and returns the holder it
+// had. It is meant for stale locks left behind by killed runs.
+func Unlock(ctx context.Context, client kubernetes.Interface, namespace, name string) (string, error) {
+	leases := client.CoordinationV1().Leases(namespace)
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if err := leases.Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return "", err
+	}
+	return ptr.Deref(lease.Spec.HolderIdentity, ""), nil
+}
@@ -0,0 +1,151 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+)
+
+func testOptions() Options {
+	return Options{
+		Namespace:     "team-a",
+		Name:          LeaseName("web"),
+		Timeout:       200 * time.Millisecond,
+		LeaseDuration: 3 * time.Second,
+		PollInterval:  20 * time.Millisecond,
+	}
+}
+
+func getLease(t *testing.T, client *fake.Clientset) *coordinationv1.Lease {
+	t.Helper()
+	lease, err := client.CoordinationV1().Leases("team-a").Get(context.Background(), "katomik-web", metav1.GetOptions{})
+	require.NoError(t, err)
+	return lease
+}
+
+func TestLeaseName(t *testing.T) {
+	assert.Equal(t, "katomik", LeaseName(""))
+	assert.Equal(t, "katomik-web", LeaseName("web"))
+}
+
+func TestAcquireRelease(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+
+	l, err := Acquire(ctx, client, testOptions(), nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, l.identity, ptr.Deref(getLease(t, client).Spec.HolderIdentity, ""))
+
+	// a second run has to wait and gives up after the timeout
+	var waitedFor string
+	_, err = Acquire(ctx, client, testOptions(), func(holder string) { waitedFor = holder }, nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrTimeout))
+	assert.Equal(t, l.identity, waitedFor)
+
+	require.NoError(t, l.Release(ctx))
+	require.NoError(t, l.Release(ctx))
+	_, err = client.CoordinationV1().Leases("team-a").Get(ctx, "katomik-web", metav1.GetOptions{})
+	assert.Error(t, err)
+
+	// free again
+	l2, err := Acquire(ctx, client, testOptions(), nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, l2.Release(ctx))
+}
+
+func TestAcquireStaleLease(t *testing.T) {
+	ctx := context.Background()
+	old := metav1.NewMicroTime(time.Now().Add(-time.Hour))
+	client := fake.NewClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "katomik-web", Namespace: "team-a"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To("crashed-run"),
+			LeaseDurationSeconds: ptr.To(int32(30)),
+			RenewTime:            &old,
+		},
+	})
+
+	l, err := Acquire(ctx, client, testOptions(), nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, l.identity, ptr.Deref(getLease(t, client).Spec.HolderIdentity, ""))
+	require.NoError(t, l.Release(ctx))
+}
+
+func TestRenewAndLost(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+
+	lost := make(chan error, 1)
+	opts := testOptions()
+	opts.LeaseDuration = 300 * time.Millisecond
+	l, err := Acquire(ctx, client, opts, nil, func(err error) { lost <- err })
+	require.NoError(t, err)
+
+	first := getLease(t, client).Spec.RenewTime.Time
+	require.Eventually(t, func() bool {
+		return getLease(t, client).Spec.RenewTime.After(first)
+	}, 2*time.Second, 20*time.Millisecond)
+
+	holder, err := Unlock(ctx, client, "team-a", "katomik-web")
+	require.NoError(t, err)
+	assert.Equal(t, l.identity, holder)
+
+	select {
+	case err := <-lost:
+		assert.Contains(t, err.Error(), "lock team-a/katomik-web lost")
+	case <-time.After(2 * time.Second):
+		t.Fatal("lost lock was not reported")
+	}
+	require.NoError(t, l.Release(ctx))
+}
+
+func TestRenewRetriesUntilExpired(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+	var failing atomic.Bool
+	client.PrependReactor("update", "leases", func(clienttesting.Action) (bool, runtime.Object, error) {
+		if failing.Load() {
+			return true, nil, apierrors.NewTimeoutError("slow apiserver", 1)
+		}
+		return false, nil, nil
+	})
+
+	lost := make(chan error, 1)
+	opts := testOptions()
+	opts.LeaseDuration = 300 * time.Millisecond
+	l, err := Acquire(ctx, client, opts, nil, func(err error) { lost <- err })
+	require.NoError(t, err)
+
+	// a single failed renewal does not lose a Lease that is still valid
+	failing.Store(true)
+	time.Sleep(opts.LeaseDuration / 2)
+	failing.Store(false)
+	select {
+	case err := <-lost:
+		t.Fatalf("lock reported lost after one failed renewal: %v", err)
+	case <-time.After(opts.LeaseDuration):
+	}
+
+	// renewals failing for the whole lease duration lose it
+	failing.Store(true)
+	select {
+	case err := <-lost:
+		assert.Contains(t, err.Error(), "lock team-a/katomik-web lost")
+	case <-time.After(2 * time.Second):
+		t.Fatal("expired lock was not reported")
+	}
+	require.NoError(t, l.Release(ctx))
+}
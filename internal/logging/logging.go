@@ -0,0 +1,132 @@
+// Package logging sets up the leveled diagnostic log of katomik.
+//
+// The log is separate from the human and structured (-o json|yaml) output of
+// the commands and always goes to stderr. client-go logs through klog, which is
+// routed into the same logger, so one -v switch covers katomik and the
+// Kubernetes client libraries alike.
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Levels accepted by --log-level besides plain numbers. Numbers follow the
+// kubectl convention: -v N enables slog level -N, so 0 is info, 4 is debug,
+// 6 adds the API requests of client-go, 8 the request and response bodies.
+var levelNames = map[string]slog.Level{
+	"error": slog.LevelError,
+	"warn":  slog.LevelWarn,
+	"info":  slog.LevelInfo,
+	"debug": slog.LevelDebug,
+}
+
+// Options describe the diagnostic log.
+//
+//	Level  - level name (error, warn, info, debug) or verbosity number; empty means warn, error with Quiet
+//	Format - text or json
+//	Quiet  - only errors are logged unless Level is given explicitly
+type Options struct {
+	Level  string
+	Format string
+	Quiet  bool
+}
+
+// ParseLevel parses a level name or a verbosity number.
+func ParseLevel(s string) (slog.Level, error) {
+	if l, ok := levelNames[strings.ToLower(s)]; ok {
+		return l, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid log level %q: must be one of error, warn, info, debug or a number >= 0", s)
+	}
+	return slog.Level(-n), nil
+}
+
+// New builds a logger writing to w.
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	logger, _, err := newLogger(w, opts)
+	return logger, err
+}
+
+func newLogger(w io.Writer, opts Options) (*slog.Logger, slog.Level, error) {
+	level := slog.LevelWarn
+	if opts.Quiet {
+		level = slog.LevelError
+	}
+	if opts.Level != "" {
+		var err error
+		if level, err = ParseLevel(opts.Level); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	hopts := &slog.HandlerOptions{Level: level}
+	switch opts.Format {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, hopts)), level, nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, hopts)), level, nil
+	default:
+		return nil, 0, fmt.Errorf("invalid log format %q: must be one of %s, %s", opts.Format, FormatText, FormatJSON)
+	}
+}
+
+// Setup installs the logger built from opts as the slog default and routes
+// klog (and with it client-go) into it.
+func Setup(w io.Writer, opts Options) error {
+	logger, level, err := newLogger(w, opts)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	// klog filters by its own verbosity before handing records to the
+	// logger: V(n) is passed on only if -v >= n
+	fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(fs)
+	if err := fs.Set("v", strconv.Itoa(Verbosity(level))); err != nil {
+		return err
+	}
+	klog.SetSlogLogger(logger)
+	return nil
+}
+
+// BodyVerbosity is the klog verbosity at which client-go logs the bodies of
+// API requests and responses.
+const BodyVerbosity = 8
+
+// CapVerbosity lowers the klog verbosity below BodyVerbosity and reports
+// whether it was higher. It is called before decrypted objects are handled:
+// the bodies of their requests would put the plaintext on stderr.
+func CapVerbosity() (bool, error) {
+	if !klog.V(BodyVerbosity).Enabled() {
+		return false, nil
+	}
+	fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(fs)
+	if err := fs.Set("v", strconv.Itoa(BodyVerbosity-1)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Verbosity is the klog verbosity matching level.
+func Verbosity(level slog.Level) int {
+	if level >= slog.LevelInfo {
+		return 0
+	}
+	return int(slog.LevelInfo - level)
+}
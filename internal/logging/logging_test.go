@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/klog/v2"
+)
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{
+		"error": slog.LevelError,
+		"WARN":  slog.LevelWarn,
+		"info":  slog.LevelInfo,
+		"debug": slog.LevelDebug,
+		"0":     slog.LevelInfo,
+		"4":     slog.LevelDebug,
+		"6":     slog.Level(-6),
+	} {
+		got, err := ParseLevel(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"trace", "-1", ""} {
+		_, err := ParseLevel(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestVerbosity(t *testing.T) {
+	assert.Equal(t, 0, Verbosity(slog.LevelError))
+	assert.Equal(t, 0, Verbosity(slog.LevelInfo))
+	assert.Equal(t, 4, Verbosity(slog.LevelDebug))
+	assert.Equal(t, 8, Verbosity(slog.Level(-8)))
+}
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{})
+	require.NoError(t, err)
+	logger.Info("hidden")
+	logger.Warn("shown")
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), "msg=shown")
+
+	buf.Reset()
+	logger, err = New(&buf, Options{Quiet: true})
+	require.NoError(t, err)
+	logger.Warn("hidden")
+	assert.Empty(t, buf.String())
+
+	buf.Reset()
+	logger, err = New(&buf, Options{Quiet: true, Level: "debug", Format: FormatJSON})
+	require.NoError(t, err)
+	logger.Debug("patch", "kind", "ConfigMap")
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	assert.Equal(t, "patch", rec["msg"])
+	assert.Equal(t, "ConfigMap", rec["kind"])
+
+	_, err = New(&buf, Options{Format: "xml"})
+	assert.Error(t, err)
+}
+
+func TestSetup_Klog(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	defer klog.ClearLogger()
+
+	var buf bytes.Buffer
+	require.NoError(t, Setup(&buf, Options{Level: "6"}))
+	klog.V(6).InfoS("GET https://cluster/api", "status", "200 OK")
+	klog.V(7).InfoS("request headers")
+	klog.Flush()
+
+	assert.Contains(t, buf.String(), "GET https://cluster/api")
+	assert.NotContains(t, buf.String(), "request headers")
+}
+
+func TestCapVerbosity(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	defer klog.ClearLogger()
+
+	var buf bytes.Buffer
+	require.NoError(t, Setup(&buf, Options{Level: "9"}))
+	capped, err := CapVerbosity()
+	require.NoError(t, err)
+	assert.True(t, capped)
+	assert.True(t, klog.V(BodyVerbosity-1).Enabled())
+	assert.False(t, klog.V(BodyVerbosity).Enabled())
+
+	capped, err = CapVerbosity()
+	require.NoError(t, err)
+	assert.False(t, capped)
+
+	require.NoError(t, Setup(&buf, Options{}))
+}
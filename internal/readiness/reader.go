@@ -0,0 +1,85 @@
+package readiness
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/engine"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/statusreaders"
+	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
+)
+
+// statusReader computes the status of every object of the kinds it claims
+// from the rules; objects of those kinds without rules fall back to kstatus.
+type statusReader struct {
+	engine.StatusReader
+	kinds map[schema.GroupKind]struct{}
+}
+
+// NewStatusReader returns a status reader for the poller that evaluates the
+// rules of objs. It only claims the kinds of objs that have rules, all other
+// kinds are left to the built-in readers. The rules of objs must have been
+// checked with Rules.For before.
+func NewStatusReader(mapper meta.RESTMapper, rules *Rules, objs []*unstructured.Unstructured) engine.StatusReader {
+	r := &statusReader{kinds: make(map[schema.GroupKind]struct{})}
+	for _, u := range objs {
+		ready, failed, err := rules.For(u)
+		if err == nil && (ready != nil || failed != nil) {
+			r.kinds[u.GroupVersionKind().GroupKind()] = struct{}{}
+		}
+	}
+	r.StatusReader = statusreaders.NewGenericStatusReader(mapper, func(u *unstructured.Unstructured) (*kstatus.Result, error) {
+		return Compute(rules, u)
+	})
+	return r
+}
+
+func (r *statusReader) Supports(gk schema.GroupKind) bool {
+	_, ok := r.kinds[gk]
+	return ok
+}
+
+// Compute returns the status of the live object u: Failed if its failure rule
+// matches, Current if its readiness rule matches and InProgress otherwise.
+// Without a readiness rule kstatus decides whether u is Current.
+//
+// A status written for an older generation (status.observedGeneration below
+// metadata.generation) says nothing about the applied spec, so the rules are
+// only evaluated once the controller has caught up.
+func Compute(rules *Rules, u *unstructured.Unstructured) (*kstatus.Result, error) {
+	ready, failed, err := rules.For(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if ready != nil || failed != nil {
+		observed, found, err := unstructured.NestedInt64(u.Object, "status", "observedGeneration")
+		if err == nil && found && observed < u.GetGeneration() {
+			msg := fmt.Sprintf("waiting for observedGeneration %d, got %d", u.GetGeneration(), observed)
+			return &kstatus.Result{Status: kstatus.InProgressStatus, Message: msg}, nil
+		}
+	}
+
+	if failed != nil {
+		ok, err := failed.Match(u)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &kstatus.Result{Status: kstatus.FailedStatus, Message: fmt.Sprintf("failed-when %s matched", failed)}, nil
+		}
+	}
+	if ready == nil {
+		return kstatus.Compute(u)
+	}
+	ok, err := ready.Match(u)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return &kstatus.Result{Status: kstatus.CurrentStatus, Message: fmt.Sprintf("ready-when %s matched", ready)}, nil
+	}
+	return &kstatus.Result{Status: kstatus.InProgressStatus, Message: fmt.Sprintf("waiting for %s", ready)}, nil
+}
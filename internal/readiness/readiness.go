@@ -0,0 +1,270 @@
+// Package readiness evaluates user-defined readiness and failure rules for
+// resources kstatus does not understand, e.g. CRs that report
+// status.phase instead of a Ready condition.
+//
+// Rules use the syntax of 'kubectl wait --for':
+//
+//	condition=Ready               - condition Ready has status True
+//	condition=Degraded=False      - condition Degraded has status False
+//	jsonpath={.status.phase}=Running
+//	jsonpath={.status.readyReplicas}  - the field is set and neither false nor empty
+//
+// They are taken from the katomik.io/ready-when and katomik.io/failed-when
+// annotations of an object or, per kind, from a rules file.
+//
+// Whether and how long an object is waited for at all is set with the
+// katomik.io/wait and katomik.io/timeout annotations (see Wait).
+package readiness
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// Annotations overriding the rules file for a single object.
+const (
+	AnnotationReadyWhen  = "katomik.io/ready-when"
+	AnnotationFailedWhen = "katomik.io/failed-when"
+)
+
+// Annotations controlling whether and how long an object is waited for.
+//
+//	AnnotationWait    - "false" skips readiness tracking for the object
+//	AnnotationTimeout - readiness deadline of the object (e.g. "10m"),
+//	                    replaces the default timeout of the run
+const (
+	AnnotationWait    = "katomik.io/wait"
+	AnnotationTimeout = "katomik.io/timeout"
+)
+
+const (
+	conditionPrefix = "condition="
+	jsonpathPrefix  = "jsonpath="
+)
+
+// Expr is a parsed readiness or failure rule.
+type Expr struct {
+	src string
+
+	// condition=Name[=Value]
+	condition string
+
+	// jsonpath={path}[=Value]
+	path *jsonpath.JSONPath
+
+	value    string
+	hasValue bool
+}
+
+// ParseExpr parses a rule in 'kubectl wait --for' syntax.
+func ParseExpr(s string) (*Expr, error) {
+	e := &Expr{src: s}
+	switch {
+	case strings.HasPrefix(s, conditionPrefix):
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(s, conditionPrefix), "=")
+		if name == "" {
+			return nil, fmt.Errorf("invalid rule %q: missing condition name", s)
+		}
+		e.condition = name
+		e.value = "True"
+		if hasValue {
+			e.value = value
+		}
+		return e, nil
+
+	case strings.HasPrefix(s, jsonpathPrefix):
+		rest := strings.TrimPrefix(s, jsonpathPrefix)
+		// the path itself may contain '=' (filters), the value starts after
+		// the closing brace
+		end := strings.LastIndex(rest, "}")
+		if !strings.HasPrefix(rest, "{") || end < 0 {
+			return nil, fmt.Errorf("invalid rule %q: the path must be enclosed in braces", s)
+		}
+		path, value := rest[:end+1], rest[end+1:]
+		if value != "" {
+			if !strings.HasPrefix(value, "=") {
+				return nil, fmt.Errorf("invalid rule %q: expected '=' after the path", s)
+			}
+			e.value, e.hasValue = strings.TrimPrefix(value, "="), true
+		}
+		e.path = jsonpath.New("rule").AllowMissingKeys(true)
+		if err := e.path.Parse(path); err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %w", s, err)
+		}
+		return e, nil
+
+	default:
+		return nil, fmt.Errorf("invalid rule %q: must start with %q or %q", s, conditionPrefix, jsonpathPrefix)
+	}
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Match evaluates the rule against u.
+func (e *Expr) Match(u *unstructured.Unstructured) (bool, error) {
+	if e.condition != "" {
+		conditions, _, err := unstructured.NestedSlice(u.Object, "status", "conditions")
+		if err != nil {
+			return false, err
+		}
+		for _, c := range conditions {
+			cond, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			if strings.EqualFold(fmt.Sprint(cond["type"]), e.condition) {
+				return strings.EqualFold(fmt.Sprint(cond["status"]), e.value), nil
+			}
+		}
+		return false, nil
+	}
+
+	results, err := e.path.FindResults(u.Object)
+	if err != nil {
+		return false, err
+	}
+	var values []reflect.Value
+	for _, r := range results {
+		values = append(values, r...)
+	}
+	if len(values) == 0 {
+		return false, nil
+	}
+	if len(values) > 1 {
+		return false, fmt.Errorf("rule %q matches %d values, expected one", e.src, len(values))
+	}
+
+	v := values[0]
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return false, nil
+		}
+		v = v.Elem()
+	}
+	if !e.hasValue {
+		return !v.IsZero(), nil
+	}
+	return fmt.Sprint(v.Interface()) == e.value, nil
+}
+
+// Wait returns whether u is waited for and its readiness deadline, which is
+// defaultTimeout unless the object sets its own.
+func Wait(u *unstructured.Unstructured, defaultTimeout time.Duration) (wait bool, timeout time.Duration, err error) {
+	annotations := u.GetAnnotations()
+	wait, timeout = true, defaultTimeout
+
+	if v, ok := annotations[AnnotationWait]; ok {
+		if wait, err = strconv.ParseBool(v); err != nil {
+			return false, 0, fmt.Errorf("invalid %s annotation %q: must be true or false", AnnotationWait, v)
+		}
+	}
+	if v, ok := annotations[AnnotationTimeout]; ok {
+		if timeout, err = time.ParseDuration(v); err != nil || timeout <= 0 {
+			return false, 0, fmt.Errorf("invalid %s annotation %q: must be a positive duration like 90s or 10m", AnnotationTimeout, v)
+		}
+	}
+	return wait, timeout, nil
+}
+
+// Rule holds the rules of one kind in a rules file.
+//
+//	Kind       - Kind or Kind.group, matched case-insensitively
+//	ReadyWhen  - rule that makes the object Current
+//	FailedWhen - rule that fails the object (and the run) right away
+type Rule struct {
+	Kind       string `json:"kind"`
+	ReadyWhen  string `json:"readyWhen,omitempty"`
+	FailedWhen string `json:"failedWhen,omitempty"`
+
+	readyWhen, failedWhen *Expr
+}
+
+// Rules are the readiness rules of a run. The zero value has no rules, only
+// annotations are honoured then.
+type Rules struct {
+	kinds []Rule
+}
+
+type rulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadFile reads a rules file:
+//
+//	rules:
+//	  - kind: Postgres.acid.zalan.do
+//	    readyWhen: jsonpath={.status.PostgresClusterStatus}=Running
+//	    failedWhen: jsonpath={.status.PostgresClusterStatus}=CreateFailed
+func LoadFile(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f rulesFile
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i := range f.Rules {
+		r := &f.Rules[i]
+		if r.Kind == "" || (r.ReadyWhen == "" && r.FailedWhen == "") {
+			return nil, fmt.Errorf("%s: rule %d needs a kind and readyWhen and/or failedWhen", path, i+1)
+		}
+		if r.readyWhen, r.failedWhen, err = parsePair(r.ReadyWhen, r.FailedWhen); err != nil {
+			return nil, fmt.Errorf("%s: kind %s: %w", path, r.Kind, err)
+		}
+	}
+	return &Rules{kinds: f.Rules}, nil
+}
+
+// For returns the readiness and failure rules of u; annotations take
+// precedence over the rules file. Both are nil if u has no rules.
+func (r *Rules) For(u *unstructured.Unstructured) (readyWhen, failedWhen *Expr, err error) {
+	annotations := u.GetAnnotations()
+	ready, failed := annotations[AnnotationReadyWhen], annotations[AnnotationFailedWhen]
+	if ready != "" || failed != "" {
+		return parsePair(ready, failed)
+	}
+
+	if r == nil {
+		return nil, nil, nil
+	}
+	gk := u.GroupVersionKind().GroupKind()
+	for i := range r.kinds {
+		if matchKind(gk, r.kinds[i].Kind) {
+			return r.kinds[i].readyWhen, r.kinds[i].failedWhen, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+func parsePair(ready, failed string) (readyWhen, failedWhen *Expr, err error) {
+	if ready != "" {
+		if readyWhen, err = ParseExpr(ready); err != nil {
+			return nil, nil, err
+		}
+	}
+	if failed != "" {
+		if failedWhen, err = ParseExpr(failed); err != nil {
+			return nil, nil, err
+		}
+	}
+	return readyWhen, failedWhen, nil
+}
+
+// matchKind reports whether gk is described by kind ("Kind" or "Kind.group").
+func matchKind(gk schema.GroupKind, kind string) bool {
+	k, group, hasGroup := strings.Cut(kind, ".")
+	return strings.EqualFold(k, gk.Kind) && (!hasGroup || strings.EqualFold(group, gk.Group))
+}
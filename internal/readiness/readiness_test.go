@@ -0,0 +1,233 @@
+package readiness
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
+)
+
+func postgres(status map[string]any) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "acid.zalan.do/v1",
+		"kind":       "Postgres",
+		"metadata":   map[string]any{"name": "db", "namespace": "default"},
+	}}
+	if status != nil {
+		u.Object["status"] = status
+	}
+	return u
+}
+
+func TestParseExpr(t *testing.T) {
+	for _, s := range []string{
+		"condition=Ready",
+		"condition=Degraded=False",
+		"jsonpath={.status.phase}=Running",
+		"jsonpath={.status.readyReplicas}",
+		`jsonpath={.status.conditions[?(@.type=="Ready")].status}=True`,
+	} {
+		e, err := ParseExpr(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, s, e.String())
+	}
+
+	for _, s := range []string{
+		"",
+		"phase=Running",
+		"condition=",
+		"jsonpath=.status.phase",
+		"jsonpath={.status.phase}Running",
+		"jsonpath={.status[}=x",
+	} {
+		_, err := ParseExpr(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestExprMatch(t *testing.T) {
+	u := postgres(map[string]any{
+		"phase":         "Running",
+		"readyReplicas": int64(2),
+		"paused":        false,
+		"conditions": []any{
+			map[string]any{"type": "Ready", "status": "True"},
+			map[string]any{"type": "Degraded", "status": "False"},
+		},
+	})
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"condition=Ready", true},
+		{"condition=ready=true", true},
+		{"condition=Degraded", false},
+		{"condition=Degraded=False", true},
+		{"condition=Missing", false},
+		{"jsonpath={.status.phase}=Running", true},
+		{"jsonpath={.status.phase}=Pending", false},
+		{"jsonpath={.status.readyReplicas}=2", true},
+		{"jsonpath={.status.readyReplicas}", true},
+		{"jsonpath={.status.paused}", false},
+		{"jsonpath={.status.missing}", false},
+		{"jsonpath={.status.missing}=x", false},
+		{`jsonpath={.status.conditions[?(@.type=="Ready")].status}=True`, true},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.expr)
+		require.NoError(t, err, tt.expr)
+		got, err := e.Match(u)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, got, tt.expr)
+	}
+
+	// several values are ambiguous
+	e, err := ParseExpr("jsonpath={.status.conditions[*].type}")
+	require.NoError(t, err)
+	_, err = e.Match(u)
+	assert.Error(t, err)
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	rules, err := LoadFile(write("ok.yaml", `
+rules:
+  - kind: Postgres.acid.zalan.do
+    readyWhen: jsonpath={.status.phase}=Running
+    failedWhen: jsonpath={.status.phase}=Failed
+  - kind: Rollout
+    readyWhen: condition=Healthy
+`))
+	require.NoError(t, err)
+
+	ready, failed, err := rules.For(postgres(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "jsonpath={.status.phase}=Running", ready.String())
+	assert.Equal(t, "jsonpath={.status.phase}=Failed", failed.String())
+
+	// annotations take precedence over the file
+	u := postgres(nil)
+	u.SetAnnotations(map[string]string{AnnotationReadyWhen: "condition=Ready"})
+	ready, failed, err = rules.For(u)
+	require.NoError(t, err)
+	assert.Equal(t, "condition=Ready", ready.String())
+	assert.Nil(t, failed)
+
+	// other groups and kinds have no rules
+	other := postgres(nil)
+	other.SetAPIVersion("example.com/v1")
+	ready, failed, err = rules.For(other)
+	require.NoError(t, err)
+	assert.Nil(t, ready)
+	assert.Nil(t, failed)
+
+	for name, content := range map[string]string{
+		"unknown-field.yaml": "rules:\n  - kind: X\n    readyWhen: condition=Ready\n    ready: x\n",
+		"no-kind.yaml":       "rules:\n  - readyWhen: condition=Ready\n",
+		"no-rule.yaml":       "rules:\n  - kind: X\n",
+		"bad-rule.yaml":      "rules:\n  - kind: X\n    readyWhen: phase=Running\n",
+	} {
+		_, err := LoadFile(write(name, content))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	rules := &Rules{}
+	u := postgres(map[string]any{"phase": "Creating"})
+	u.SetAnnotations(map[string]string{
+		AnnotationReadyWhen:  "jsonpath={.status.phase}=Running",
+		AnnotationFailedWhen: "jsonpath={.status.phase}=Failed",
+	})
+
+	res, err := Compute(rules, u)
+	require.NoError(t, err)
+	assert.Equal(t, kstatus.InProgressStatus, res.Status)
+	assert.Contains(t, res.Message, "waiting for")
+
+	require.NoError(t, unstructured.SetNestedField(u.Object, "Running", "status", "phase"))
+	res, err = Compute(rules, u)
+	require.NoError(t, err)
+	assert.Equal(t, kstatus.CurrentStatus, res.Status)
+
+	require.NoError(t, unstructured.SetNestedField(u.Object, "Failed", "status", "phase"))
+	res, err = Compute(rules, u)
+	require.NoError(t, err)
+	assert.Equal(t, kstatus.FailedStatus, res.Status)
+
+	// without rules kstatus decides: a CR without status is Current
+	res, err = Compute(rules, postgres(nil))
+	require.NoError(t, err)
+	assert.Equal(t, kstatus.CurrentStatus, res.Status)
+}
+
+func TestCompute_StaleStatus(t *testing.T) {
+	u := postgres(map[string]any{"phase": "Running", "observedGeneration": int64(1)})
+	u.SetGeneration(2)
+	u.SetAnnotations(map[string]string{AnnotationReadyWhen: "jsonpath={.status.phase}=Running"})
+
+	// the status is the one of the previous spec
+	res, err := Compute(&Rules{}, u)
+	require.NoError(t, err)
+	assert.Equal(t, kstatus.InProgressStatus, res.Status)
+	assert.Contains(t, res.Message, "waiting for observedGeneration")
+
+	require.NoError(t, unstructured.SetNestedField(u.Object, int64(2), "status", "observedGeneration"))
+	res, err = Compute(&Rules{}, u)
+	require.NoError(t, err)
+	assert.Equal(t, kstatus.CurrentStatus, res.Status)
+}
+
+func TestStatusReaderSupports(t *testing.T) {
+	annotated := postgres(nil)
+	annotated.SetAnnotations(map[string]string{AnnotationReadyWhen: "condition=Ready"})
+	plain := &unstructured.Unstructured{}
+	plain.SetAPIVersion("v1")
+	plain.SetKind("ConfigMap")
+
+	r := NewStatusReader(nil, &Rules{}, []*unstructured.Unstructured{annotated, plain})
+	assert.True(t, r.Supports(schema.GroupKind{Group: "acid.zalan.do", Kind: "Postgres"}))
+	assert.False(t, r.Supports(schema.GroupKind{Kind: "ConfigMap"}))
+}
+
+func TestWait(t *testing.T) {
+	u := postgres(nil)
+	wait, timeout, err := Wait(u, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, wait)
+	assert.Equal(t, time.Minute, timeout)
+
+	u.SetAnnotations(map[string]string{AnnotationWait: "false"})
+	wait, _, err = Wait(u, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, wait)
+
+	u.SetAnnotations(map[string]string{AnnotationTimeout: "10m"})
+	wait, timeout, err = Wait(u, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, wait)
+	assert.Equal(t, 10*time.Minute, timeout)
+
+	for _, annotations := range []map[string]string{
+		{AnnotationWait: "nope"},
+		{AnnotationTimeout: "10"},
+		{AnnotationTimeout: "-1m"},
+	} {
+		u.SetAnnotations(annotations)
+		_, _, err := Wait(u, time.Minute)
+		assert.Error(t, err, annotations)
+	}
+}
@@ -0,0 +1,351 @@
+package resolve
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRemoteTimeout     = 30 * time.Second
+	DefaultRemoteMaxBodySize = 10 << 20 // 10MiB
+	DefaultRemoteRetries     = 2
+
+	// checksumFragment is the URL fragment prefix used to pin remote content,
+	// e.g. https://example.com/app.yaml#sha256=<hex>
+	checksumFragment = "sha256="
+)
+
+// RemoteOptions configures how manifests referenced by URL are fetched.
+//
+//	Timeout     - per-request timeout (including reading the body)
+//	MaxBodySize - maximum accepted response size in bytes
+//	Retries     - how many times a failed request is retried (network errors, 429, 5xx)
+//	Headers     - extra request headers in "Name: value" form
+//	TokenEnv    - name of an environment variable holding a bearer token
+//	TokenFile   - path to a file holding a bearer token
+//	TokenHost   - host (host[:port]) the token is sent to; empty means the
+//	              host of the URLs passed to BindToken, or of the first URL
+//	              fetched
+//	CAFile      - PEM bundle appended to the system roots
+//	Checksums   - expected sha256 (hex) per URL, in "URL=HEX" form
+type RemoteOptions struct {
+	Timeout     time.Duration
+	MaxBodySize int64
+	Retries     int
+	Headers     []string
+	TokenEnv    string
+	TokenFile   string
+	TokenHost   string
+	CAFile      string
+	Checksums   []string
+}
+
+// DefaultRemoteOptions returns the options used when nothing was configured.
+func DefaultRemoteOptions() RemoteOptions {
+	return RemoteOptions{
+		Timeout:     DefaultRemoteTimeout,
+		MaxBodySize: DefaultRemoteMaxBodySize,
+		Retries:     DefaultRemoteRetries,
+	}
+}
+
+// RemoteClient fetches remote manifests according to RemoteOptions.
+//
+// The bearer token is only sent to its host: requests to other hosts and
+// redirects leaving the host go without it.
+type RemoteClient struct {
+	client      *http.Client
+	headers     http.Header
+	token       string
+	mu          sync.Mutex
+	tokenHost   string
+	maxBodySize int64
+	retries     int
+	retryWait   time.Duration
+	checksums   map[string]string
+}
+
+// NewRemoteClient validates opts and builds a ready to use RemoteClient.
+func NewRemoteClient(opts *RemoteOptions) (*RemoteClient, error) {
+	if opts == nil {
+		defaults := DefaultRemoteOptions()
+		opts = &defaults
+	}
+
+	rc := &RemoteClient{
+		headers:     http.Header{},
+		maxBodySize: opts.MaxBodySize,
+		retries:     opts.Retries,
+		retryWait:   time.Second,
+		checksums:   map[string]string{},
+	}
+	if rc.maxBodySize <= 0 {
+		rc.maxBodySize = DefaultRemoteMaxBodySize
+	}
+	if rc.retries < 0 {
+		rc.retries = 0
+	}
+
+	for _, h := range opts.Headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected 'Name: value'", h)
+		}
+		rc.headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	token, err := readToken(opts.TokenEnv, opts.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	rc.token = token
+	rc.tokenHost = opts.TokenHost
+
+	for _, c := range opts.Checksums {
+		i := strings.LastIndex(c, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid checksum %q, expected 'URL=SHA256'", c)
+		}
+		sum, err := normalizeChecksum(c[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		rc.checksums[stripFragment(c[:i])] = sum
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", opts.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultRemoteTimeout
+	}
+	rc.client = &http.Client{Transport: transport, Timeout: timeout, CheckRedirect: checkRedirect}
+	return rc, nil
+}
+
+// checkRedirect follows redirects like the default policy of http.Client but
+// drops the Authorization header as soon as a redirect leaves the host of
+// the original request, subdomains included.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
+
+// BindToken binds the bearer token to the host of urls (local paths are
+// ignored) when no host was configured. The token is meant for one host: if
+// urls span more than one, it is not guessed which one gets it and an error
+// asks for TokenHost instead.
+func (rc *RemoteClient) BindToken(urls []string) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.token == "" || rc.tokenHost != "" {
+		return nil
+	}
+
+	var hosts []string
+	for _, u := range urls {
+		if !isURL(u) {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Host == "" {
+			return fmt.Errorf("invalid URL: %s", u)
+		}
+		if !slices.ContainsFunc(hosts, func(h string) bool { return strings.EqualFold(h, parsed.Host) }) {
+			hosts = append(hosts, parsed.Host)
+		}
+	}
+	if len(hosts) > 1 {
+		return fmt.Errorf("bearer token given for URLs on %d hosts (%s), choose its host with --remote-token-host",
+			len(hosts), strings.Join(hosts, ", "))
+	}
+	if len(hosts) == 1 {
+		rc.tokenHost = hosts[0]
+	}
+	return nil
+}
+
+// authorizes reports whether the bearer token may be sent to u; without a
+// configured or bound host the token is bound to the host of the first URL.
+func (rc *RemoteClient) authorizes(u *url.URL) bool {
+	if rc.token == "" {
+		return false
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.tokenHost == "" {
+		rc.tokenHost = u.Host
+	}
+	return strings.EqualFold(rc.tokenHost, u.Host)
+}
+
+// Fetch downloads the content of inputURL. A '#sha256=<hex>' fragment or a
+// configured checksum for the URL is verified before the content is returned.
+// Cancelling ctx aborts the request and the wait between retries.
+func (rc *RemoteClient) Fetch(ctx context.Context, inputURL string) ([]byte, error) {
+	// Parse and validate the URL
+	parsedURL, err := url.Parse(inputURL)
+	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid URL: %s", inputURL)
+	}
+
+	expected := rc.checksums[stripFragment(inputURL)]
+	if strings.HasPrefix(parsedURL.Fragment, checksumFragment) {
+		sum, err := normalizeChecksum(strings.TrimPrefix(parsedURL.Fragment, checksumFragment))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", inputURL, err)
+		}
+		if expected != "" && expected != sum {
+			return nil, fmt.Errorf("conflicting checksums for %s", inputURL)
+		}
+		expected = sum
+	}
+	parsedURL.Fragment = ""
+	auth := rc.authorizes(parsedURL)
+
+	var body []byte
+	for attempt := 0; ; attempt++ {
+		var retryable bool
+		slog.Debug("fetching remote manifest", "url", parsedURL.Redacted(), "attempt", attempt+1)
+		body, retryable, err = rc.get(ctx, parsedURL.String(), auth)
+		if err == nil || !retryable || attempt >= rc.retries {
+			break
+		}
+		slog.Info("remote request failed, retrying", "url", parsedURL.Redacted(), "attempt", attempt+1, "error", err)
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(rc.retryWait * time.Duration(attempt+1)):
+			continue
+		}
+		break
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot GET file content from: %s: %w", parsedURL.Redacted(), err)
+	}
+
+	slog.Debug("fetched remote manifest", "url", parsedURL.Redacted(), "bytes", len(body), "verified", expected != "")
+	if expected != "" {
+		got := sha256.Sum256(body)
+		if hex.EncodeToString(got[:]) != expected {
+			return nil, fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %x", parsedURL.Redacted(), expected, got)
+		}
+	}
+	return body, nil
+}
+
+// get performs a single request, with the bearer token if auth is set, and
+// reports whether a failure is worth retrying.
+func (rc *RemoteClient) get(ctx context.Context, u string, auth bool) (body []byte, retryable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, false, err
+	}
+	for name, values := range rc.headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if auth {
+		req.Header.Set("Authorization", "Bearer "+rc.token)
+	}
+
+	response, err := rc.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer response.Body.Close()
+
+	// Check for HTTP errors
+	if response.StatusCode != http.StatusOK {
+		retryable = response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+		return nil, retryable, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	if response.ContentLength > rc.maxBodySize {
+		return nil, false, fmt.Errorf("response size %d exceeds limit of %d bytes", response.ContentLength, rc.maxBodySize)
+	}
+
+	// Read the response body, one extra byte tells us the limit was exceeded
+	body, err = io.ReadAll(io.LimitReader(response.Body, rc.maxBodySize+1))
+	if err != nil {
+		return nil, true, err
+	}
+	if int64(len(body)) > rc.maxBodySize {
+		return nil, false, fmt.Errorf("response exceeds limit of %d bytes", rc.maxBodySize)
+	}
+	return body, false, nil
+}
+
+func readToken(envName, file string) (string, error) {
+	if envName != "" && file != "" {
+		return "", errors.New("bearer token can be taken either from env or from file, not both")
+	}
+	if envName != "" {
+		token, ok := os.LookupEnv(envName)
+		if !ok || strings.TrimSpace(token) == "" {
+			return "", fmt.Errorf("environment variable %s with bearer token is empty", envName)
+		}
+		return strings.TrimSpace(token), nil
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("reading token file: %w", err)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file %s is empty", file)
+		}
+		return token, nil
+	}
+	return "", nil
+}
+
+func normalizeChecksum(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid sha256 checksum %q", s)
+	}
+	return s, nil
+}
+
+func stripFragment(u string) string {
+	if i := strings.Index(u, "#"); i >= 0 {
+		return u[:i]
+	}
+	return u
+}
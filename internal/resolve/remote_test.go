@@ -0,0 +1,281 @@
+package resolve
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const remoteContent = "apiVersion: v1\nkind: ConfigMap\n"
+
+func remoteSum() string {
+	sum := sha256.Sum256([]byte(remoteContent))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRemoteClient_Checksum(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, remoteContent)
+	}))
+	defer server.Close()
+
+	wrong := strings.Repeat("0", 64)
+
+	tests := []struct {
+		name      string
+		url       string
+		checksums []string
+		wantErr   bool
+	}{
+		{name: "no checksum", url: server.URL},
+		{name: "matching fragment", url: server.URL + "#sha256=" + remoteSum()},
+		{name: "mismatching fragment", url: server.URL + "#sha256=" + wrong, wantErr: true},
+		{name: "invalid fragment", url: server.URL + "#sha256=xyz", wantErr: true},
+		{name: "matching flag", url: server.URL, checksums: []string{server.URL + "=" + remoteSum()}},
+		{name: "mismatching flag", url: server.URL, checksums: []string{server.URL + "=" + wrong}, wantErr: true},
+		{
+			name:      "conflicting fragment and flag",
+			url:       server.URL + "#sha256=" + remoteSum(),
+			checksums: []string{server.URL + "=" + wrong},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultRemoteOptions()
+			opts.Checksums = tt.checksums
+			rc, err := NewRemoteClient(&opts)
+			require.NoError(t, err)
+
+			got, err := rc.Fetch(context.Background(), tt.url)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, remoteContent, string(got))
+		})
+	}
+}
+
+func TestRemoteClient_MaxBodySize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, remoteContent)
+	}))
+	defer server.Close()
+
+	opts := DefaultRemoteOptions()
+	opts.MaxBodySize = 8
+	rc, err := NewRemoteClient(&opts)
+	require.NoError(t, err)
+
+	_, err = rc.Fetch(context.Background(), server.URL)
+	assert.Error(t, err)
+}
+
+func TestRemoteClient_HeadersAndToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" || r.Header.Get("X-Team") != "platform" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, remoteContent)
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cr3t\n"), 0o600))
+	t.Setenv("KATOMIK_TEST_TOKEN", "s3cr3t")
+
+	t.Run("token from file", func(t *testing.T) {
+		opts := DefaultRemoteOptions()
+		opts.Headers = []string{"X-Team: platform"}
+		opts.TokenFile = tokenFile
+		rc, err := NewRemoteClient(&opts)
+		require.NoError(t, err)
+		_, err = rc.Fetch(context.Background(), server.URL)
+		assert.NoError(t, err)
+	})
+
+	t.Run("token from env", func(t *testing.T) {
+		opts := DefaultRemoteOptions()
+		opts.Headers = []string{"X-Team: platform"}
+		opts.TokenEnv = "KATOMIK_TEST_TOKEN"
+		rc, err := NewRemoteClient(&opts)
+		require.NoError(t, err)
+		_, err = rc.Fetch(context.Background(), server.URL)
+		assert.NoError(t, err)
+	})
+
+	t.Run("token is not leaked in errors", func(t *testing.T) {
+		opts := DefaultRemoteOptions()
+		opts.TokenEnv = "KATOMIK_TEST_TOKEN"
+		rc, err := NewRemoteClient(&opts)
+		require.NoError(t, err)
+		_, err = rc.Fetch(context.Background(), server.URL)
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), "s3cr3t")
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		opts := DefaultRemoteOptions()
+		opts.Headers = []string{"no-colon"}
+		_, err := NewRemoteClient(&opts)
+		assert.Error(t, err)
+	})
+}
+
+func TestRemoteClient_Retries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, remoteContent)
+	}))
+	defer server.Close()
+
+	opts := DefaultRemoteOptions()
+	opts.Retries = 2
+	rc, err := NewRemoteClient(&opts)
+	require.NoError(t, err)
+	rc.retryWait = 0
+
+	got, err := rc.Fetch(context.Background(), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, remoteContent, string(got))
+	assert.Equal(t, int32(3), calls.Load())
+
+	// not found is not retried
+	calls.Store(0)
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	_, err = rc.Fetch(context.Background(), notFound.URL)
+	assert.Error(t, err)
+}
+
+func TestRemoteClient_TokenScope(t *testing.T) {
+	var leaked atomic.Bool
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			leaked.Store(true)
+		}
+		fmt.Fprint(w, remoteContent)
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, other.URL+"/app.yaml", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, remoteContent)
+	}))
+	defer server.Close()
+	t.Setenv("KATOMIK_TEST_TOKEN", "s3cr3t")
+
+	t.Run("bound to the first host", func(t *testing.T) {
+		leaked.Store(false)
+		opts := DefaultRemoteOptions()
+		opts.TokenEnv = "KATOMIK_TEST_TOKEN"
+		rc, err := NewRemoteClient(&opts)
+		require.NoError(t, err)
+		_, err = rc.Fetch(context.Background(), server.URL)
+		require.NoError(t, err)
+		_, err = rc.Fetch(context.Background(), other.URL)
+		require.NoError(t, err)
+		assert.False(t, leaked.Load(), "the token is not sent to other hosts")
+	})
+
+	t.Run("configured host", func(t *testing.T) {
+		leaked.Store(false)
+		opts := DefaultRemoteOptions()
+		opts.TokenEnv = "KATOMIK_TEST_TOKEN"
+		opts.TokenHost = strings.TrimPrefix(server.URL, "http://")
+		rc, err := NewRemoteClient(&opts)
+		require.NoError(t, err)
+		_, err = rc.Fetch(context.Background(), other.URL)
+		require.NoError(t, err)
+		_, err = rc.Fetch(context.Background(), server.URL)
+		require.NoError(t, err)
+		assert.False(t, leaked.Load())
+	})
+
+	t.Run("several hosts need a configured host", func(t *testing.T) {
+		opts := DefaultRemoteOptions()
+		opts.TokenEnv = "KATOMIK_TEST_TOKEN"
+		rc, err := NewRemoteClient(&opts)
+		require.NoError(t, err)
+		err = rc.BindToken([]string{other.URL + "/a.yaml", "local.yaml", server.URL + "/b.yaml"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "--remote-token-host")
+
+		opts.TokenHost = strings.TrimPrefix(server.URL, "http://")
+		rc, err = NewRemoteClient(&opts)
+		require.NoError(t, err)
+		require.NoError(t, rc.BindToken([]string{other.URL + "/a.yaml", server.URL + "/b.yaml"}))
+	})
+
+	t.Run("bound to the host of the URLs", func(t *testing.T) {
+		leaked.Store(false)
+		opts := DefaultRemoteOptions()
+		opts.TokenEnv = "KATOMIK_TEST_TOKEN"
+		rc, err := NewRemoteClient(&opts)
+		require.NoError(t, err)
+		require.NoError(t, rc.BindToken([]string{"local.yaml", server.URL + "/a.yaml", server.URL + "/b.yaml"}))
+		// fetched before the bound host, other still does not get the token
+		_, err = rc.Fetch(context.Background(), other.URL)
+		require.NoError(t, err)
+		_, err = rc.Fetch(context.Background(), server.URL)
+		require.NoError(t, err)
+		assert.False(t, leaked.Load())
+	})
+
+	t.Run("not forwarded on cross-host redirects", func(t *testing.T) {
+		leaked.Store(false)
+		opts := DefaultRemoteOptions()
+		opts.TokenEnv = "KATOMIK_TEST_TOKEN"
+		rc, err := NewRemoteClient(&opts)
+		require.NoError(t, err)
+		got, err := rc.Fetch(context.Background(), server.URL+"/moved")
+		require.NoError(t, err)
+		assert.Equal(t, remoteContent, string(got))
+		assert.False(t, leaked.Load())
+	})
+}
+
+func TestRemoteClient_RetryCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	opts := DefaultRemoteOptions()
+	opts.Retries = 5
+	rc, err := NewRemoteClient(&opts)
+	require.NoError(t, err)
+	rc.retryWait = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = rc.Fetch(ctx, server.URL)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -1,10 +1,10 @@
 package resolve
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"io/fs"
-	"net/http"
+	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -14,9 +14,17 @@ import (
 
 var FileExtensions = []string{".json", ".yaml", ".yml"}
 
-func ReadFileContent(filename string) ([]byte, error) {
+// ReadFileContent reads a local file or, for URLs, fetches it with rc.
+// A nil rc fetches remote content with DefaultRemoteOptions.
+func ReadFileContent(ctx context.Context, filename string, rc *RemoteClient) ([]byte, error) {
 	if isURL(filename) {
-		return readRemoteFileContent(filename)
+		if rc == nil {
+			var err error
+			if rc, err = NewRemoteClient(nil); err != nil {
+				return nil, err
+			}
+		}
+		return rc.Fetch(ctx, filename)
 	}
 	return os.ReadFile(filename)
 }
@@ -33,6 +41,7 @@ func ResolveAllFiles(filenames []string, recursive bool) ([]string, error) {
 	}
 	// Ensure consistent order
 	sort.Strings(result)
+	slog.Debug("resolved manifest files", "args", filenames, "files", result)
 	return result, nil
 }
 
@@ -105,31 +114,3 @@ func ignoreFile(path string, extensions []string) bool {
 	}
 	return true
 }
-
-func readRemoteFileContent(inputURL string) ([]byte, error) {
-	// Parse and validate the URL
-	parsedURL, err := url.Parse(inputURL)
-	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
-		return nil, fmt.Errorf("invalid URL: %s", inputURL)
-	}
-
-	// Make the HTTP GET request
-	response, err := http.Get(parsedURL.String())
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
-
-	// Check for HTTP errors
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("cannot GET file content from: %s", inputURL)
-	}
-
-	// Read the response body
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return body, nil
-}
@@ -1,6 +1,7 @@
 package resolve
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -305,7 +306,11 @@ func TestReadRemoteFileContent(t *testing.T) {
 			}
 
 			// Call the function under test
-			got, err := readRemoteFileContent(inputURL)
+			rc, err := NewRemoteClient(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := rc.Fetch(context.Background(), inputURL)
 
 			// Check for errors
 			if tt.wantError {
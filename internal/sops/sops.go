@@ -0,0 +1,211 @@
+// Package sops decrypts SOPS-encrypted YAML/JSON manifests in memory.
+//
+// Decryption is done by the upstream SOPS library, following its decrypt
+// package step by step, so every key type sops supports works here too. Age
+// identities are found the way the sops CLI finds them: SOPS_AGE_KEY,
+// SOPS_AGE_KEY_FILE, SOPS_AGE_KEY_CMD and the default
+// $XDG_CONFIG_HOME/sops/age/keys.txt, unless a key file is passed to Decrypt.
+//
+// Only the packages needed to decrypt are imported (the sops tree, the YAML
+// and JSON stores, the AES cipher, the age keysource and the key service). The
+// whole module still shows up in go.mod: the sops tree resolves data keys
+// through the key service, which links every key source sops has (KMS, GCP,
+// Azure, Vault, PGP).
+//
+// Plaintext values never appear in errors produced by this package.
+package sops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	sopsv3 "github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	"github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/config"
+	"github.com/getsops/sops/v3/keyservice"
+	sopsjson "github.com/getsops/sops/v3/stores/json"
+	sopsyaml "github.com/getsops/sops/v3/stores/yaml"
+	yaml "go.yaml.in/yaml/v3"
+)
+
+const (
+	// AgeKeyEnv holds age identities inline (same variable as the sops CLI).
+	AgeKeyEnv = "SOPS_AGE_KEY"
+	// AgeKeyFileEnv points to a file with age identities (same variable as the sops CLI).
+	AgeKeyFileEnv = "SOPS_AGE_KEY_FILE"
+
+	metadataKey = "sops"
+)
+
+// IsEncrypted reports whether data is a SOPS-encrypted YAML or JSON stream,
+// i.e. whether its first document carries a 'sops' metadata mapping.
+func IsEncrypted(data []byte) bool {
+	if !bytes.Contains(data, []byte(metadataKey)) {
+		return false
+	}
+	var doc yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		return false
+	}
+	return hasMetadata(&doc)
+}
+
+// Decrypt decrypts a SOPS-encrypted YAML or JSON stream and returns its
+// documents as generic maps, with the 'sops' metadata removed. Empty documents
+// are kept as nil entries so positions match the input. The MAC is verified
+// over the whole stream, exactly like the sops CLI does.
+//
+// keyFile, if not empty, is a file with age identities; only these are used
+// for age keys then, the environment is not consulted.
+func Decrypt(data []byte, keyFile string) ([]map[string]interface{}, error) {
+	asJSON := isJSON(data)
+	cleartext, err := decryptData(data, asJSON, keyFile)
+	if err != nil {
+		var ue userError
+		if errors.As(err, &ue) {
+			return nil, errors.New("sops: " + ue.UserError())
+		}
+		return nil, fmt.Errorf("sops: %w", err)
+	}
+
+	if asJSON {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(cleartext, &doc); err != nil {
+			// do not wrap the original error, it may quote decrypted values
+			return nil, errors.New("sops: invalid decrypted document")
+		}
+		return []map[string]interface{}{doc}, nil
+	}
+
+	var docs []map[string]interface{}
+	dec := yaml.NewDecoder(bytes.NewReader(cleartext))
+	for {
+		var doc map[string]interface{}
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sops: document %d is not a mapping", len(docs))
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// userError is implemented by the SOPS errors that have a longer, more
+// helpful message for humans (e.g. which key sources were tried).
+type userError interface {
+	UserError() string
+}
+
+// store is the part of the sops stores decryptData needs.
+type store interface {
+	LoadEncryptedFile(in []byte) (sopsv3.Tree, error)
+	EmitPlainFile(branches sopsv3.TreeBranches) ([]byte, error)
+}
+
+// decryptData decrypts the tree in data and verifies its MAC, the same steps
+// as decrypt.Data of sops. The data key is obtained through a local key
+// service; with keyFile the service decrypts age keys with the identities of
+// that file instead of the ones found in the environment.
+func decryptData(data []byte, asJSON bool, keyFile string) ([]byte, error) {
+	stores := config.NewStoresConfig()
+	var st store = sopsyaml.NewStore(&stores.YAML)
+	if asJSON {
+		st = sopsjson.NewStore(&stores.JSON)
+	}
+
+	svc := keyservice.NewLocalClient()
+	if keyFile != "" {
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading age key file: %w", err)
+		}
+		var ids age.ParsedIdentities
+		if err := ids.Import(string(content)); err != nil {
+			return nil, fmt.Errorf("age key file %s: %w", keyFile, err)
+		}
+		svc = keyservice.NewCustomLocalClient(ageKeyServer{identities: ids})
+	}
+
+	tree, err := st.LoadEncryptedFile(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := tree.Metadata.GetDataKeyWithKeyServices([]keyservice.KeyServiceClient{svc}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher := aes.NewCipher()
+	mac, err := tree.Decrypt(key, cipher)
+	if err != nil {
+		return nil, err
+	}
+	// the MAC stored in the file covers the cleartext tree
+	originalMac, err := cipher.Decrypt(
+		tree.Metadata.MessageAuthenticationCode,
+		key,
+		tree.Metadata.LastModified.Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting the MAC: %w", err)
+	}
+	if originalMac != mac {
+		return nil, errors.New("failed to verify data integrity: MAC mismatch")
+	}
+	return st.EmitPlainFile(tree.Branches)
+}
+
+// ageKeyServer is the local sops key service with fixed age identities, every
+// other key type is handled by the default service.
+type ageKeyServer struct {
+	keyservice.Server
+	identities age.ParsedIdentities
+}
+
+// Decrypt decrypts the data key of an age recipient with the identities of
+// the server.
+func (s ageKeyServer) Decrypt(ctx context.Context, req *keyservice.DecryptRequest) (*keyservice.DecryptResponse, error) {
+	k, ok := req.Key.KeyType.(*keyservice.Key_AgeKey)
+	if !ok {
+		return s.Server.Decrypt(ctx, req)
+	}
+	mk := &age.MasterKey{Recipient: k.AgeKey.Recipient, EncryptedKey: string(req.Ciphertext)}
+	s.identities.ApplyToMasterKey(mk)
+	plaintext, err := mk.Decrypt()
+	if err != nil {
+		return nil, err
+	}
+	return &keyservice.DecryptResponse{Plaintext: plaintext}, nil
+}
+
+func isJSON(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// hasMetadata reports whether the top-level mapping of a document node has a
+// 'sops' mapping.
+func hasMetadata(doc *yaml.Node) bool {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return false
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == metadataKey && root.Content[i+1].Kind == yaml.MappingNode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package sops
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Fixtures in testdata were encrypted with the sops CLI for the identity in
+// testdata/keys.txt.
+
+// isolate hides the age identities of the environment running the tests.
+func isolate(t *testing.T) {
+	t.Helper()
+	t.Setenv(AgeKeyEnv, "")
+	t.Setenv(AgeKeyFileEnv, os.DevNull)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	return data
+}
+
+func TestIsEncrypted(t *testing.T) {
+	assert.True(t, IsEncrypted(readFixture(t, "secret.enc.yaml")))
+	assert.True(t, IsEncrypted(readFixture(t, "secret.enc.json")))
+	assert.False(t, IsEncrypted([]byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: sops\n")))
+	assert.False(t, IsEncrypted([]byte("not: [valid")))
+}
+
+func TestDecrypt(t *testing.T) {
+	isolate(t)
+	keyFile := filepath.Join("testdata", "keys.txt")
+
+	t.Run("multi document with encrypted_regex", func(t *testing.T) {
+		docs, err := Decrypt(readFixture(t, "secret.enc.yaml"), keyFile)
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+
+		assert.NotContains(t, docs[0], "sops")
+		stringData := docs[0]["stringData"].(map[string]interface{})
+		assert.Equal(t, "admin", stringData["username"])
+		assert.Equal(t, "sup3r-s3cr3t-pa55", stringData["password"])
+		assert.Equal(t, "db-credentials", docs[0]["metadata"].(map[string]interface{})["name"])
+
+		data := docs[1]["data"].(map[string]interface{})
+		assert.Equal(t, "plain-token-value", data["token"])
+	})
+
+	t.Run("fully encrypted with typed values", func(t *testing.T) {
+		docs, err := Decrypt(readFixture(t, "full.enc.yaml"), keyFile)
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+
+		spec := docs[0]["spec"].(map[string]interface{})
+		assert.Equal(t, 3, spec["replicas"])
+		assert.InDelta(t, 0.5, spec["ratio"], 0)
+		assert.Equal(t, false, spec["debug"])
+		assert.Equal(t, []interface{}{"one", "two"}, spec["items"])
+		assert.Equal(t, "ConfigMap", docs[0]["kind"])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		docs, err := Decrypt(readFixture(t, "secret.enc.json"), keyFile)
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Equal(t, "json-s3cr3t", docs[0]["stringData"].(map[string]interface{})["key"])
+	})
+
+	t.Run("mac only encrypted", func(t *testing.T) {
+		docs, err := Decrypt(readFixture(t, "maconly.enc.yaml"), keyFile)
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+	})
+}
+
+func TestDecrypt_Tampered(t *testing.T) {
+	isolate(t)
+	keyFile := filepath.Join("testdata", "keys.txt")
+
+	// plaintext fields are covered by the MAC as well
+	data := strings.Replace(string(readFixture(t, "secret.enc.yaml")), "name: db-credentials", "name: hijacked", 1)
+	_, err := Decrypt([]byte(data), keyFile)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "data integrity")
+}
+
+func TestDecrypt_WrongKey(t *testing.T) {
+	isolate(t)
+	keyFile := filepath.Join("testdata", "other-keys.txt")
+	_, err := Decrypt(readFixture(t, "secret.enc.yaml"), keyFile)
+	assert.Error(t, err)
+}
+
+func TestDecrypt_NoKeys(t *testing.T) {
+	isolate(t)
+	_, err := Decrypt(readFixture(t, "secret.enc.yaml"), "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), AgeKeyEnv)
+}
+
+func TestDecrypt_ErrorsDoNotLeakPlaintext(t *testing.T) {
+	isolate(t)
+	keyFile := filepath.Join("testdata", "keys.txt")
+
+	// break the ciphertext of the password so decryption fails mid-way
+	data := string(readFixture(t, "secret.enc.yaml"))
+	data = strings.Replace(data, "iv:GIUdgv7sPt5FYa7D6OacAcMHAv9xySRZTiMQba17DSY=", "iv:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", 1)
+
+	_, err := Decrypt([]byte(data), keyFile)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "admin")
+	assert.NotContains(t, err.Error(), "sup3r-s3cr3t-pa55")
+	assert.NotContains(t, err.Error(), "ENC[")
+}
+
+func TestDecrypt_KeyFromEnv(t *testing.T) {
+	isolate(t)
+	t.Setenv(AgeKeyEnv, string(readFixture(t, "keys.txt")))
+
+	docs, err := Decrypt(readFixture(t, "secret.enc.json"), "")
+	require.NoError(t, err)
+	assert.Len(t, docs, 1)
+}
+
+func TestDecrypt_KeyFileIgnoresEnv(t *testing.T) {
+	isolate(t)
+	t.Setenv(AgeKeyEnv, string(readFixture(t, "other-keys.txt")))
+
+	docs, err := Decrypt(readFixture(t, "secret.enc.json"), filepath.Join("testdata", "keys.txt"))
+	require.NoError(t, err)
+	assert.Len(t, docs, 1)
+	assert.Equal(t, os.DevNull, os.Getenv(AgeKeyFileEnv))
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// MergeObjects deep-merges src into dst. Maps are merged key by key, every
+// other value (scalars and lists) must either be absent in dst or equal in
+// both objects. The paths of all conflicting values are returned in the error,
+// dst is left untouched in that case.
+func MergeObjects(dst, src map[string]interface{}) error {
+	var conflicts []string
+	collectConflicts(dst, src, "", &conflicts)
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("conflicting values at %s", strings.Join(conflicts, ", "))
+	}
+	mergeMaps(dst, src)
+	return nil
+}
+
+func collectConflicts(dst, src map[string]interface{}, prefix string, conflicts *[]string) {
+	for k, sv := range src {
+		dv, ok := dst[k]
+		if !ok {
+			continue
+		}
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		dm, dIsMap := dv.(map[string]interface{})
+		sm, sIsMap := sv.(map[string]interface{})
+		if dIsMap && sIsMap {
+			collectConflicts(dm, sm, path, conflicts)
+			continue
+		}
+		if !reflect.DeepEqual(dv, sv) {
+			*conflicts = append(*conflicts, path)
+		}
+	}
+}
+
+func mergeMaps(dst, src map[string]interface{}) {
+	for k, sv := range src {
+		dm, dIsMap := dst[k].(map[string]interface{})
+		sm, sIsMap := sv.(map[string]interface{})
+		if dIsMap && sIsMap {
+			mergeMaps(dm, sm)
+			continue
+		}
+		dst[k] = sv
+	}
+}
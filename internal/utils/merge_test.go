@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeObjects(t *testing.T) {
+	dst := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":   "app",
+			"labels": map[string]interface{}{"app": "web"},
+		},
+		"data": map[string]interface{}{"a": "1"},
+	}
+	src := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":   "app",
+			"labels": map[string]interface{}{"tier": "frontend"},
+		},
+		"data": map[string]interface{}{"b": "2"},
+	}
+
+	require.NoError(t, MergeObjects(dst, src))
+	assert.Equal(t, map[string]interface{}{"app": "web", "tier": "frontend"},
+		dst["metadata"].(map[string]interface{})["labels"])
+	assert.Equal(t, map[string]interface{}{"a": "1", "b": "2"}, dst["data"])
+}
+
+func TestMergeObjects_Conflicts(t *testing.T) {
+	dst := map[string]interface{}{
+		"data":  map[string]interface{}{"a": "1", "b": "2"},
+		"items": []interface{}{"x"},
+	}
+	src := map[string]interface{}{
+		"data":  map[string]interface{}{"a": "changed", "b": "2"},
+		"items": []interface{}{"y"},
+	}
+
+	err := MergeObjects(dst, src)
+	require.Error(t, err)
+	assert.Equal(t, "conflicting values at data.a, items", err.Error())
+	// nothing merged on conflict
+	assert.Equal(t, "1", dst["data"].(map[string]interface{})["a"])
+}
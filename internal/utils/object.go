@@ -1,46 +1,268 @@
 package utils
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 
+	"github.com/hashmap-kz/katomik/internal/logging"
+	"github.com/hashmap-kz/katomik/internal/sops"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
 )
 
+// ReadOptions tune how manifests are decoded by ReadObjectsWithOptions.
+//
+//	AgeKeyFile - file with age identities used to decrypt SOPS-encrypted
+//	             input, in place of the ones of the environment (see sops.Decrypt)
+type ReadOptions struct {
+	AgeKeyFile string
+}
+
+// Source describes where a decoded object comes from.
+//
+//	File  - file path, URL or "(stdin)"
+//	Index - zero-based index of the YAML document (or JSON object) in File,
+//	        documents without content are not counted
+//	Line  - 1-based line the document content starts at, 0 if unknown
+type Source struct {
+	File  string
+	Index int
+	Line  int
+}
+
+// String formats the source as "file:line (doc N)", the line is omitted when
+// it is not known.
+func (s Source) String() string {
+	if s.File == "" {
+		return ""
+	}
+	if s.Line > 0 {
+		return fmt.Sprintf("%s:%d (doc %d)", s.File, s.Line, s.Index+1)
+	}
+	return fmt.Sprintf("%s (doc %d)", s.File, s.Index+1)
+}
+
+// Document is a decoded object along with its Source.
+type Document struct {
+	Object *unstructured.Unstructured
+	Source Source
+}
+
 func ReadObjects(r io.Reader) ([]*unstructured.Unstructured, error) {
-	reader := yamlutil.NewYAMLOrJSONDecoder(r, 2048)
-	objects := make([]*unstructured.Unstructured, 0)
+	return ReadObjectsWithOptions(r, &ReadOptions{})
+}
 
-	for {
-		obj := &unstructured.Unstructured{}
-		err := reader.Decode(obj)
-		if err != nil {
+// ReadObjectsWithOptions decodes all Kubernetes objects from r, see ReadDocuments.
+func ReadObjectsWithOptions(r io.Reader, opts *ReadOptions) ([]*unstructured.Unstructured, error) {
+	docs, err := ReadDocuments(r, "", opts)
+	objects := make([]*unstructured.Unstructured, 0, len(docs))
+	for _, d := range docs {
+		objects = append(objects, d.Object)
+	}
+	return objects, err
+}
+
+// ReadDocuments decodes all Kubernetes objects from r and records for each of
+// them the document it was found in; file is only used as a label. SOPS-encrypted
+// input is decrypted in memory, the plaintext is never written anywhere.
+func ReadDocuments(r io.Reader, file string, opts *ReadOptions) ([]Document, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if sops.IsEncrypted(data) {
+		return readEncryptedDocuments(data, file, opts)
+	}
+
+	if yamlutil.IsJSONBuffer(bytes.TrimSpace(data)) {
+		return readJSONDocuments(data, file)
+	}
+
+	var docs []Document
+	for index, chunk := range splitYAMLDocuments(data) {
+		src := Source{File: file, Index: index, Line: chunk.line}
+
+		reader := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader(chunk.data), 2048)
+		for {
+			obj := &unstructured.Unstructured{}
+			if err := reader.Decode(obj); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return docs, sourceError(src, err)
+			}
+			if docs, err = appendDocument(docs, obj, src); err != nil {
+				return docs, sourceError(src, err)
+			}
+		}
+	}
+
+	return docs, nil
+}
+
+// readJSONDocuments decodes a stream of JSON objects. Such streams have no
+// separators, every object is a document.
+func readJSONDocuments(data []byte, file string) ([]Document, error) {
+	var docs []Document
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for index := 0; ; index++ {
+		src := Source{File: file, Index: index}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
 			if err == io.EOF {
-				//nolint:ineffassign
-				err = nil
 				break
 			}
-			return objects, err
-		}
-
-		if obj.IsList() {
-			err = obj.EachListItem(func(item runtime.Object) error {
-				//nolint:errcheck
-				obj := item.(*unstructured.Unstructured)
-				objects = append(objects, obj)
-				return nil
-			})
-			if err != nil {
-				return objects, err
+			return docs, sourceError(src, err)
+		}
+		start := int(dec.InputOffset()) - len(raw)
+		src.Line = bytes.Count(data[:start], []byte("\n")) + 1
+
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(raw); err != nil {
+			return docs, sourceError(src, err)
+		}
+		var err error
+		if docs, err = appendDocument(docs, obj, src); err != nil {
+			return docs, sourceError(src, err)
+		}
+	}
+	return docs, nil
+}
+
+// yamlDocument is a single document of a YAML stream.
+//
+//	data - document bytes without the separator
+//	line - 1-based line of the first line that is not blank or a comment
+type yamlDocument struct {
+	data []byte
+	line int
+}
+
+// splitYAMLDocuments splits a YAML stream on "---" separators the same way
+// yamlutil.YAMLReader does, but remembers where every document starts.
+// Documents that contain only blank lines and comments are dropped.
+func splitYAMLDocuments(data []byte) []yamlDocument {
+	var docs []yamlDocument
+	cur := yamlDocument{}
+
+	flush := func() {
+		if cur.line > 0 {
+			docs = append(docs, cur)
+		}
+		cur = yamlDocument{}
+	}
+
+	lineNo := 0
+	for len(data) > 0 {
+		lineNo++
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		}
+		data = data[len(line):]
+
+		if rest, ok := bytes.CutPrefix(line, []byte("---")); ok {
+			rest = bytes.TrimSpace(rest)
+			if len(rest) == 0 || rest[0] == '#' {
+				flush()
+				continue
 			}
-			continue
 		}
 
-		if IsKubernetesObject(obj) && !IsKustomization(obj) {
-			objects = append(objects, obj)
+		cur.data = append(cur.data, line...)
+		if cur.line == 0 {
+			trimmed := bytes.TrimSpace(line)
+			if len(trimmed) > 0 && trimmed[0] != '#' {
+				cur.line = lineNo
+			}
 		}
 	}
+	flush()
+
+	return docs
+}
+
+func readEncryptedDocuments(data []byte, file string, opts *ReadOptions) ([]Document, error) {
+	// client-go would log the decrypted objects as request bodies
+	capped, err := logging.CapVerbosity()
+	if err != nil {
+		return nil, err
+	}
+	if capped {
+		slog.Warn("log verbosity lowered, request bodies are not logged for SOPS-encrypted input",
+			"file", file, "verbosity", logging.BodyVerbosity-1)
+	}
+
+	decrypted, err := sops.Decrypt(data, opts.AgeKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// line numbers are taken from the encrypted input, the layout of the
+	// documents does not change during encryption
+	var chunks []yamlDocument
+	if !yamlutil.IsJSONBuffer(bytes.TrimSpace(data)) {
+		chunks = splitYAMLDocuments(data)
+	}
 
-	return objects, nil
+	docs := make([]Document, 0, len(decrypted))
+	index := -1
+	for _, doc := range decrypted {
+		if doc == nil {
+			continue
+		}
+		index++
+		src := Source{File: file, Index: index, Line: 1}
+		if len(chunks) > 0 {
+			src.Line = 0
+			if index < len(chunks) {
+				src.Line = chunks[index].line
+			}
+		}
+		// round-trip through JSON so numbers get the types unstructured expects
+		obj := &unstructured.Unstructured{}
+		b, err := json.Marshal(doc)
+		if err == nil {
+			err = obj.UnmarshalJSON(b)
+		}
+		if err == nil {
+			docs, err = appendDocument(docs, obj, src)
+		}
+		if err != nil {
+			// do not wrap the original error, it may quote decrypted values
+			return nil, sourceError(src, errors.New("invalid decrypted document"))
+		}
+	}
+	return docs, nil
+}
+
+func sourceError(src Source, err error) error {
+	if src.File == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", src, err)
+}
+
+// appendDocument appends obj (or the items of a List) if it is a valid object.
+func appendDocument(docs []Document, obj *unstructured.Unstructured, src Source) ([]Document, error) {
+	if obj.IsList() {
+		err := obj.EachListItem(func(item runtime.Object) error {
+			//nolint:errcheck
+			obj := item.(*unstructured.Unstructured)
+			docs = append(docs, Document{Object: obj, Source: src})
+			return nil
+		})
+		return docs, err
+	}
+
+	if IsKubernetesObject(obj) && !IsKustomization(obj) {
+		docs = append(docs, Document{Object: obj, Source: src})
+	}
+	return docs, nil
 }
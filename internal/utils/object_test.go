@@ -2,10 +2,13 @@ package utils
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -164,3 +167,91 @@ stringData:
 		})
 	}
 }
+
+func TestReadObjects_SOPS(t *testing.T) {
+	t.Setenv("SOPS_AGE_KEY", "")
+	t.Setenv("SOPS_AGE_KEY_FILE", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	data, err := os.ReadFile(filepath.Join("..", "sops", "testdata", "secret.enc.yaml"))
+	require.NoError(t, err)
+
+	objects, err := ReadObjectsWithOptions(bytes.NewReader(data), &ReadOptions{
+		AgeKeyFile: filepath.Join("..", "sops", "testdata", "keys.txt"),
+	})
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+
+	assert.Equal(t, "db-credentials", objects[0].GetName())
+	assert.Nil(t, objects[0].Object["sops"])
+	password, _, err := unstructured.NestedString(objects[0].Object, "stringData", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "sup3r-s3cr3t-pa55", password)
+
+	docs, err := ReadDocuments(bytes.NewReader(data), "secret.enc.yaml", &ReadOptions{
+		AgeKeyFile: filepath.Join("..", "sops", "testdata", "keys.txt"),
+	})
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	assert.Equal(t, "secret.enc.yaml:27 (doc 2)", docs[1].Source.String())
+
+	// without identities the file cannot be read
+	_, err = ReadObjects(bytes.NewReader(data))
+	assert.Error(t, err)
+}
+
+func TestReadDocuments_Source(t *testing.T) {
+	t.Run("yaml", func(t *testing.T) {
+		input := `# leading comment
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+---
+---
+
+# comment before the object
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: second
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: third
+`
+		docs, err := ReadDocuments(strings.NewReader(input), "app.yaml", &ReadOptions{})
+		require.NoError(t, err)
+		require.Len(t, docs, 3)
+
+		assert.Equal(t, Source{File: "app.yaml", Index: 0, Line: 3}, docs[0].Source)
+		assert.Equal(t, Source{File: "app.yaml", Index: 1, Line: 11}, docs[1].Source)
+		assert.Equal(t, docs[1].Source, docs[2].Source)
+		assert.Equal(t, "app.yaml:11 (doc 2)", docs[2].Source.String())
+	})
+
+	t.Run("json stream", func(t *testing.T) {
+		input := `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a"}}
+
+{
+  "apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "b"}
+}`
+		docs, err := ReadDocuments(strings.NewReader(input), "app.json", &ReadOptions{})
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+		assert.Equal(t, 1, docs[0].Source.Line)
+		assert.Equal(t, 3, docs[1].Source.Line)
+		assert.Equal(t, 1, docs[1].Source.Index)
+	})
+
+	t.Run("decode errors name the document", func(t *testing.T) {
+		input := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: ok\n---\nkind: [broken\n"
+		_, err := ReadDocuments(strings.NewReader(input), "bad.yaml", &ReadOptions{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "bad.yaml:6 (doc 2)")
+	})
+}
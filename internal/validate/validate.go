@@ -0,0 +1,483 @@
+// Package validate checks decoded manifests against OpenAPI v3 schemas
+// before anything is sent to the cluster.
+//
+// Schemas can be taken from the cluster (/openapi/v3), from OpenAPI v3
+// documents stored on disk (e.g. 'kubectl get --raw /openapi/v3/apis/apps/v1')
+// and from CustomResourceDefinitions, so validation also works fully offline.
+//
+// The checks are structural: unknown fields, wrong value types, missing
+// required fields and enum values. Everything else is left to the API server.
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashmap-kz/katomik/internal/utils"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/openapi"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+// ErrNoSchema is returned by Validate when no schema is known for the object's GVK.
+var ErrNoSchema = errors.New("no schema found")
+
+const (
+	extGVK                   = "x-kubernetes-group-version-kind"
+	extPreserveUnknownFields = "x-kubernetes-preserve-unknown-fields"
+	extIntOrString           = "x-kubernetes-int-or-string"
+	extEmbeddedResource      = "x-kubernetes-embedded-resource"
+)
+
+// FieldError is a single schema violation.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// entry is a root schema plus the definitions its $refs point to.
+type entry struct {
+	schema *spec.Schema
+	defs   map[string]*spec.Schema
+	crd    bool
+}
+
+// Validator holds schemas indexed by GroupVersionKind.
+type Validator struct {
+	schemas map[schema.GroupVersionKind]*entry
+
+	// cluster is consulted lazily, once per group-version
+	cluster openapi.Client
+	paths   map[string]openapi.GroupVersion
+	fetched map[string]bool
+}
+
+func New() *Validator {
+	return &Validator{
+		schemas: map[schema.GroupVersionKind]*entry{},
+		fetched: map[string]bool{},
+	}
+}
+
+// UseCluster makes the validator download missing schemas from the cluster.
+// Schemas added explicitly (files, CRDs) take precedence.
+func (v *Validator) UseCluster(c openapi.Client) {
+	v.cluster = c
+}
+
+// AddOpenAPIDocument registers every schema of an OpenAPI v3 document that
+// declares x-kubernetes-group-version-kind.
+func (v *Validator) AddOpenAPIDocument(data []byte) error {
+	var doc struct {
+		OpenAPI    string `json:"openapi"`
+		Components struct {
+			Schemas map[string]*spec.Schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing OpenAPI document: %w", err)
+	}
+	if doc.OpenAPI == "" {
+		return errors.New("not an OpenAPI v3 document")
+	}
+
+	for _, s := range doc.Components.Schemas {
+		for _, gvk := range gvksOf(s) {
+			if _, ok := v.schemas[gvk]; ok {
+				continue
+			}
+			v.schemas[gvk] = &entry{schema: s, defs: doc.Components.Schemas}
+		}
+	}
+	return nil
+}
+
+// AddCRD registers the schemas of all served versions of a CustomResourceDefinition.
+func (v *Validator) AddCRD(crd *unstructured.Unstructured) error {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	if group == "" || kind == "" {
+		return fmt.Errorf("CRD %s has no group or kind", crd.GetName())
+	}
+
+	add := func(version string, raw interface{}) error {
+		if raw == nil {
+			return nil
+		}
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		s := &spec.Schema{}
+		if err := json.Unmarshal(b, s); err != nil {
+			return fmt.Errorf("CRD %s: invalid openAPIV3Schema: %w", crd.GetName(), err)
+		}
+		v.schemas[schema.GroupVersionKind{Group: group, Version: version, Kind: kind}] = &entry{schema: s, crd: true}
+		return nil
+	}
+
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, item := range versions {
+		ver, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(ver, "name")
+		raw, _, _ := unstructured.NestedFieldNoCopy(ver, "schema", "openAPIV3Schema")
+		if raw == nil {
+			// v1beta1 CRDs may declare a single schema for all versions
+			raw, _, _ = unstructured.NestedFieldNoCopy(crd.Object, "spec", "validation", "openAPIV3Schema")
+		}
+		if err := add(name, raw); err != nil {
+			return err
+		}
+	}
+	if len(versions) == 0 {
+		version, _, _ := unstructured.NestedString(crd.Object, "spec", "version")
+		raw, _, _ := unstructured.NestedFieldNoCopy(crd.Object, "spec", "validation", "openAPIV3Schema")
+		return add(version, raw)
+	}
+	return nil
+}
+
+// LoadDir registers OpenAPI v3 documents (*.json) and CRD manifests
+// (*.yaml, *.yml, *.json) found under dir, recursively.
+func (v *Validator) LoadDir(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if ext != ".json" && ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if ext == ".json" && v.AddOpenAPIDocument(data) == nil {
+			return nil
+		}
+
+		objs, err := utils.ReadObjects(strings.NewReader(string(data)))
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		for _, o := range objs {
+			if utils.IsCRD(o) {
+				if err := v.AddCRD(o); err != nil {
+					return fmt.Errorf("%s: %w", p, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Validate checks obj against the schema of its GVK. It returns ErrNoSchema
+// when the schema is unknown, and the list of violations otherwise.
+func (v *Validator) Validate(obj *unstructured.Unstructured) ([]FieldError, error) {
+	gvk := obj.GroupVersionKind()
+	e, err := v.lookup(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &walker{defs: e.defs}
+	w.object(obj.Object, e.schema, "", true, e.crd)
+	return w.errs, nil
+}
+
+func (v *Validator) lookup(gvk schema.GroupVersionKind) (*entry, error) {
+	if e, ok := v.schemas[gvk]; ok {
+		return e, nil
+	}
+	if v.cluster != nil {
+		v.fetch(gvk.GroupVersion())
+		if e, ok := v.schemas[gvk]; ok {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%w for %s", ErrNoSchema, gvk)
+}
+
+// fetch downloads the schemas of gv from the cluster. A cluster that cannot
+// serve them is treated like one without them: the failure is logged and the
+// objects of gv end up with ErrNoSchema, so validation degrades instead of
+// failing the run.
+func (v *Validator) fetch(gv schema.GroupVersion) {
+	path := "apis/" + gv.Group + "/" + gv.Version
+	if gv.Group == "" {
+		path = "api/" + gv.Version
+	}
+	if v.fetched[path] {
+		return
+	}
+	v.fetched[path] = true
+
+	if v.paths == nil {
+		paths, err := v.cluster.Paths()
+		if err != nil {
+			slog.Warn("cannot fetch OpenAPI v3 paths, skipping cluster schemas", "error", err)
+			paths = map[string]openapi.GroupVersion{}
+		}
+		v.paths = paths
+	}
+	gvClient, ok := v.paths[path]
+	if !ok {
+		return
+	}
+	data, err := gvClient.Schema("application/json")
+	if err == nil {
+		err = v.AddOpenAPIDocument(data)
+	}
+	if err != nil {
+		slog.Warn("cannot fetch OpenAPI v3 schema", "groupVersion", gv.String(), "error", err)
+	}
+}
+
+func gvksOf(s *spec.Schema) []schema.GroupVersionKind {
+	raw, ok := s.Extensions[extGVK]
+	if !ok {
+		return nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil
+	}
+	var res []schema.GroupVersionKind
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		g, _ := m["group"].(string)
+		ver, _ := m["version"].(string)
+		k, _ := m["kind"].(string)
+		res = append(res, schema.GroupVersionKind{Group: g, Version: ver, Kind: k})
+	}
+	return res
+}
+
+// walker walks a value and its schema side by side, collecting violations.
+type walker struct {
+	defs map[string]*spec.Schema
+	errs []FieldError
+}
+
+func (w *walker) fail(path, format string, args ...interface{}) {
+	w.errs = append(w.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// resolve follows $ref and single-element allOf wrappers (used by the API
+// server to attach defaults to referenced types).
+func (w *walker) resolve(s *spec.Schema) *spec.Schema {
+	for i := 0; i < 32 && s != nil; i++ {
+		if ref := s.Ref.String(); ref != "" {
+			name := ref[strings.LastIndex(ref, "/")+1:]
+			next, ok := w.defs[name]
+			if !ok {
+				return nil
+			}
+			s = next
+			continue
+		}
+		if len(s.AllOf) == 1 && len(s.Type) == 0 && len(s.Properties) == 0 {
+			s = &s.AllOf[0]
+			continue
+		}
+		return s
+	}
+	return s
+}
+
+// types returns the accepted JSON types of s, nil means anything.
+func types(s *spec.Schema) []string {
+	if len(s.Type) > 0 {
+		if s.Format == "int-or-string" {
+			return []string{"integer", "string"}
+		}
+		return s.Type
+	}
+	if b, _ := s.Extensions.GetBool(extIntOrString); b || s.Format == "int-or-string" {
+		return []string{"integer", "string"}
+	}
+	if len(s.Properties) > 0 {
+		return []string{"object"}
+	}
+	if s.Items != nil {
+		return []string{"array"}
+	}
+	var union []string
+	for _, branches := range [][]spec.Schema{s.OneOf, s.AnyOf} {
+		for i := range branches {
+			if len(branches[i].Type) == 0 {
+				return nil
+			}
+			union = append(union, branches[i].Type...)
+		}
+	}
+	return union
+}
+
+func (w *walker) value(val interface{}, s *spec.Schema, path string) {
+	s = w.resolve(s)
+	if s == nil || val == nil {
+		return
+	}
+	if b, _ := s.Extensions.GetBool(extIntOrString); b {
+		s = &spec.Schema{SchemaProps: spec.SchemaProps{Type: []string{"integer", "string"}}}
+	}
+
+	accepted := types(s)
+	actual := typeOf(val)
+	if len(accepted) > 0 && !typeMatches(actual, accepted) {
+		w.fail(path, "expected %s, got %s", strings.Join(accepted, " or "), actual)
+		return
+	}
+
+	switch v := val.(type) {
+	case map[string]interface{}:
+		w.object(v, s, path, false, false)
+	case []interface{}:
+		if s.Items == nil || s.Items.Schema == nil {
+			return
+		}
+		for i, item := range v {
+			w.value(item, s.Items.Schema, fmt.Sprintf("%s[%d]", path, i))
+		}
+	default:
+		if len(s.Enum) > 0 && !inEnum(val, s.Enum) {
+			// the value itself is not echoed: it may be decrypted SOPS data
+			w.fail(path, "unsupported value, expected one of %s", enumString(s.Enum))
+		}
+	}
+}
+
+func (w *walker) object(obj map[string]interface{}, s *spec.Schema, path string, root, crd bool) {
+	s = w.resolve(s)
+	if s == nil {
+		return
+	}
+
+	preserve, _ := s.Extensions.GetBool(extPreserveUnknownFields)
+	embedded, _ := s.Extensions.GetBool(extEmbeddedResource)
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p := join(path, k)
+		if (root || embedded) && (k == "apiVersion" || k == "kind" || k == "metadata") {
+			// CRD schemas can not constrain metadata, embedded resources
+			// may omit the type meta from their schema
+			if _, ok := s.Properties[k]; !ok || (crd && k == "metadata") {
+				continue
+			}
+		}
+		if prop, ok := s.Properties[k]; ok {
+			w.value(obj[k], &prop, p)
+			continue
+		}
+		if ap := s.AdditionalProperties; ap != nil {
+			if ap.Schema != nil {
+				w.value(obj[k], ap.Schema, p)
+			}
+			if ap.Schema != nil || ap.Allows {
+				continue
+			}
+		}
+		// free-form objects have neither properties nor additionalProperties
+		if preserve || len(s.Properties) == 0 {
+			continue
+		}
+		w.fail(p, "unknown field %q", k)
+	}
+
+	for _, r := range s.Required {
+		if _, ok := obj[r]; !ok {
+			w.fail(join(path, r), "required field is missing")
+		}
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int32, int64:
+		return "integer"
+	case float64:
+		// JSON has no integers, whole numbers are accepted where integers are expected
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func typeMatches(actual string, accepted []string) bool {
+	for _, t := range accepted {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func inEnum(v interface{}, enum []interface{}) bool {
+	s := fmt.Sprint(v)
+	for _, e := range enum {
+		if fmt.Sprint(e) == s {
+			return true
+		}
+	}
+	return false
+}
+
+func enumString(enum []interface{}) string {
+	parts := make([]string, 0, len(enum))
+	for _, e := range enum {
+		parts = append(parts, fmt.Sprintf("%q", fmt.Sprint(e)))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
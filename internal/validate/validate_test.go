@@ -0,0 +1,196 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashmap-kz/katomik/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/openapi"
+)
+
+func testValidator(t *testing.T) *Validator {
+	t.Helper()
+	v := New()
+	require.NoError(t, v.LoadDir("testdata"))
+	return v
+}
+
+func decode(t *testing.T, manifest string) *unstructured.Unstructured {
+	t.Helper()
+	objs, err := utils.ReadObjects(strings.NewReader(manifest))
+	require.NoError(t, err)
+	require.Len(t, objs, 1)
+	return objs[0]
+}
+
+const validDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: web
+  strategy:
+    type: RollingUpdate
+    rollingUpdate:
+      maxSurge: 1
+      maxUnavailable: 25%
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+        - name: web
+          image: nginx
+          imagePullPolicy: IfNotPresent
+          ports:
+            - containerPort: 80
+          env:
+            - name: MODE
+              value: "prod"
+          resources:
+            limits:
+              cpu: 1
+              memory: 128Mi
+`
+
+func TestValidate_Valid(t *testing.T) {
+	v := testValidator(t)
+	errs, err := v.Validate(decode(t, validDeployment))
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+}
+
+func TestValidate_Errors(t *testing.T) {
+	v := testValidator(t)
+
+	tests := []struct {
+		name    string
+		replace [2]string
+		want    string
+	}{
+		{
+			name:    "unknown field",
+			replace: [2]string{"replicas: 2", "replica: 2"},
+			want:    `spec.replica: unknown field "replica"`,
+		},
+		{
+			name:    "wrong type",
+			replace: [2]string{"replicas: 2", "replicas: two"},
+			want:    "spec.replicas: expected integer, got string",
+		},
+		{
+			name:    "string expected",
+			replace: [2]string{`value: "prod"`, "value: 8080"},
+			want:    "spec.template.spec.containers[0].env[0].value: expected string, got integer",
+		},
+		{
+			name:    "enum",
+			replace: [2]string{"imagePullPolicy: IfNotPresent", "imagePullPolicy: always"},
+			want:    `spec.template.spec.containers[0].imagePullPolicy: unsupported value, expected one of [`,
+		},
+		{
+			name:    "required",
+			replace: [2]string{"- containerPort: 80", "- name: http"},
+			want:    "spec.template.spec.containers[0].ports[0].containerPort: required field is missing",
+		},
+		{
+			name:    "int-or-string",
+			replace: [2]string{"maxSurge: 1", "maxSurge: true"},
+			want:    "spec.strategy.rollingUpdate.maxSurge: expected integer or string, got boolean",
+		},
+		{
+			name:    "unknown top-level field",
+			replace: [2]string{"spec:\n  replicas: 2", "replicas: 2\nspec:"},
+			want:    `replicas: unknown field "replicas"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := strings.Replace(validDeployment, tt.replace[0], tt.replace[1], 1)
+			errs, err := v.Validate(decode(t, manifest))
+			require.NoError(t, err)
+			require.NotEmpty(t, errs)
+
+			msgs := make([]string, 0, len(errs))
+			for _, e := range errs {
+				msgs = append(msgs, e.Error())
+			}
+			assert.Contains(t, strings.Join(msgs, "\n"), tt.want)
+		})
+	}
+}
+
+func TestValidate_CRD(t *testing.T) {
+	v := testValidator(t)
+
+	valid := `
+apiVersion: example.com/v1
+kind: Database
+metadata:
+  name: main
+  annotations:
+    anything: goes
+spec:
+  engine: postgres
+  storage: 10Gi
+  settings:
+    max_connections: 100
+`
+	errs, err := v.Validate(decode(t, valid))
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+
+	invalid := strings.Replace(valid, "engine: postgres", "engine: oracle\n  replicas: 3", 1)
+	errs, err = v.Validate(decode(t, invalid))
+	require.NoError(t, err)
+	require.Len(t, errs, 2)
+	assert.Equal(t, "spec.engine", errs[0].Path)
+	assert.Equal(t, `spec.replicas: unknown field "replicas"`, errs[1].Error())
+}
+
+func TestValidate_NoSchema(t *testing.T) {
+	v := testValidator(t)
+	_, err := v.Validate(decode(t, `
+apiVersion: example.com/v2
+kind: Unknown
+metadata:
+  name: x
+`))
+	assert.True(t, errors.Is(err, ErrNoSchema))
+}
+
+// brokenCluster is an openapi.Client whose discovery always fails.
+type brokenCluster struct{}
+
+func (brokenCluster) Paths() (map[string]openapi.GroupVersion, error) {
+	return nil, errors.New("the server could not find the requested resource")
+}
+
+func TestValidate_ClusterFetchFails(t *testing.T) {
+	v := testValidator(t)
+	v.UseCluster(brokenCluster{})
+
+	_, err := v.Validate(decode(t, `
+apiVersion: example.com/v2
+kind: Unknown
+metadata:
+  name: x
+`))
+	assert.True(t, errors.Is(err, ErrNoSchema), "an unreachable schema is a missing one")
+
+	errs, err := v.Validate(decode(t, validDeployment))
+	require.NoError(t, err, "schemas loaded from files are still used")
+	assert.Empty(t, errs)
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/hashmap-kz/katomik/cmd"
+	"github.com/hashmap-kz/katomik/internal/apply"
 	"k8s.io/cli-runtime/pkg/genericiooptions"
 )
 
@@ -13,6 +14,6 @@ func main() {
 	rootCmd := cmd.NewRootCmd(streams)
 	if err := rootCmd.Execute(); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "error executing cmd: %v\n", err)
-		os.Exit(1)
+		os.Exit(apply.ExitCode(err))
 	}
 }
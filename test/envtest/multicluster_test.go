@@ -0,0 +1,188 @@
+//go:build envtest
+
+// Package envtest runs katomik against several envtest API servers (etcd and
+// kube-apiserver only, no controllers). KUBEBUILDER_ASSETS must point to the
+// binaries, e.g. KUBEBUILDER_ASSETS=$(setup-envtest use -p path).
+package envtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+var (
+	contexts   = []string{"east", "west"}
+	clients    = map[string]*kubernetes.Clientset{}
+	binary     string
+	kubeconfig string
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		fmt.Println("KUBEBUILDER_ASSETS is not set, skipping envtest tests")
+		os.Exit(0)
+	}
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	tmp, err := os.MkdirTemp("", "katomik-envtest")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	binary = filepath.Join(tmp, "katomik")
+	build := exec.Command("go", "build", "-o", binary, "../..")
+	build.Stdout, build.Stderr = os.Stdout, os.Stderr
+	if err := build.Run(); err != nil {
+		panic(err)
+	}
+
+	cfg := clientcmdapi.NewConfig()
+	for _, name := range contexts {
+		env := &envtest.Environment{}
+		restCfg, err := env.Start()
+		if err != nil {
+			panic(err)
+		}
+		//nolint:errcheck
+		defer env.Stop()
+
+		clients[name] = kubernetes.NewForConfigOrDie(restCfg)
+		addContext(cfg, name, restCfg)
+	}
+
+	kubeconfig = filepath.Join(tmp, "kubeconfig")
+	if err := clientcmd.WriteToFile(*cfg, kubeconfig); err != nil {
+		panic(err)
+	}
+	return m.Run()
+}
+
+func addContext(cfg *clientcmdapi.Config, name string, restCfg *rest.Config) {
+	cfg.Clusters[name] = &clientcmdapi.Cluster{
+		Server:                   restCfg.Host,
+		CertificateAuthorityData: restCfg.CAData,
+	}
+	cfg.AuthInfos[name] = &clientcmdapi.AuthInfo{
+		ClientCertificateData: restCfg.CertData,
+		ClientKeyData:         restCfg.KeyData,
+		Token:                 restCfg.BearerToken,
+	}
+	cfg.Contexts[name] = &clientcmdapi.Context{Cluster: name, AuthInfo: name}
+	cfg.CurrentContext = name
+}
+
+func katomik(t *testing.T, manifest string, args ...string) (string, error) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "manifest.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(manifest), 0o644))
+
+	args = append([]string{"apply", "-f", file, "--kubeconfig", kubeconfig,
+		"--contexts", strings.Join(contexts, ",")}, args...)
+	out, err := exec.Command(binary, args...).CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	return string(out), err
+}
+
+func configMapExists(t *testing.T, cluster, namespace, name string) bool {
+	t.Helper()
+	_, err := clients[cluster].CoreV1().ConfigMaps(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	return err == nil
+}
+
+func TestApplyAllClusters(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		t.Run(fmt.Sprintf("parallel=%v", parallel), func(t *testing.T) {
+			name := fmt.Sprintf("release-%v", parallel)
+			out, err := katomik(t, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: `+name+`
+data:
+  version: "1"
+`, "--timeout", "30s", fmt.Sprintf("--parallel-clusters=%v", parallel))
+			require.NoError(t, err)
+
+			for _, c := range contexts {
+				assert.True(t, configMapExists(t, c, "default", name), c)
+				assert.Contains(t, out, fmt.Sprintf("=== context %q", c))
+			}
+		})
+	}
+}
+
+func TestApplyFailureInOneClusterRollsBackAll(t *testing.T) {
+	// the namespace only exists in the first cluster, so the apply fails in
+	// the second one after the first cluster was changed already
+	_, err := clients["east"].CoreV1().Namespaces().Create(context.Background(),
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "only-east"}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	out, err := katomik(t, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cross-cluster
+  namespace: only-east
+data:
+  version: "1"
+`, "--timeout", "30s")
+	require.Error(t, err)
+	assert.Contains(t, out, `context "west"`)
+	assert.Contains(t, out, "rollback complete")
+
+	assert.False(t, configMapExists(t, "east", "only-east", "cross-cluster"))
+}
+
+func TestReadinessFailureRollsBackAll(t *testing.T) {
+	// envtest runs no controllers, the deployment never becomes available
+	_, err := katomik(t, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: with-deployment
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: never-ready
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: never-ready
+  template:
+    metadata:
+      labels:
+        app: never-ready
+    spec:
+      containers:
+        - name: app
+          image: nginx
+`, "--timeout", "10s", "--parallel-clusters")
+	require.Error(t, err)
+
+	for _, c := range contexts {
+		assert.False(t, configMapExists(t, c, "default", "with-deployment"), c)
+		_, err := clients[c].AppsV1().Deployments("default").Get(context.Background(), "never-ready", metav1.GetOptions{})
+		assert.Error(t, err, c)
+	}
+}
@@ -0,0 +1,68 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashmap-kz/katomik/internal/apply"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRollbackKeepsNamespaceWithForeignObjects(t *testing.T) {
+	ctx := context.Background()
+	kube := kubeClient(t)
+	path := filepath.Join(t.TempDir(), "release.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: cascade-foreign
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: never-ready
+  namespace: cascade-foreign
+  annotations:
+    katomik.io/ready-when: jsonpath={.data.state}=ok
+data:
+  state: pending
+`), 0o644))
+	t.Cleanup(func() {
+		_ = kube.CoreV1().Namespaces().Delete(ctx, "cascade-foreign", metav1.DeleteOptions{})
+	})
+
+	// someone else adds an object to the new namespace during the run
+	go func() {
+		for i := 0; i < 100; i++ {
+			_, err := kube.CoreV1().ConfigMaps("cascade-foreign").Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "intruder"},
+			}, metav1.CreateOptions{})
+			if err == nil {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+
+	out, err := exec.Command("katomik", "apply", "-f", path, "--timeout", "10s").CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.Error(t, err)
+	assert.Equal(t, apply.ExitReadinessRolledBack, exitCode(err))
+	assert.Contains(t, string(out), "kept Namespace/cascade-foreign")
+	assert.Contains(t, string(out), "ConfigMap/intruder")
+
+	_, err = kube.CoreV1().ConfigMaps("cascade-foreign").Get(ctx, "intruder", metav1.GetOptions{})
+	assert.NoError(t, err, "the foreign object must survive the rollback")
+	_, err = kube.CoreV1().ConfigMaps("cascade-foreign").Get(ctx, "never-ready", metav1.GetOptions{})
+	assert.Error(t, err, "the objects of the run must still be rolled back")
+}
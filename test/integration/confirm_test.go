@@ -0,0 +1,57 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashmap-kz/katomik/internal/apply"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConfirmation(t *testing.T) {
+	ctx := context.Background()
+	cms := kubeClient(t).CoreV1().ConfigMaps("default")
+	t.Cleanup(func() {
+		_ = cms.Delete(ctx, "confirmed", metav1.DeleteOptions{})
+	})
+	path := filepath.Join(t.TempDir(), "cm.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: confirmed
+data:
+  a: "1"
+`), 0o644))
+
+	// every context is protected
+	declined := exec.Command("katomik", "apply", "-f", path, "--protected-contexts", "*")
+	declined.Stdin = strings.NewReader("no\n")
+	out, err := declined.CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.Error(t, err)
+	assert.Equal(t, apply.ExitDeclined, exitCode(err))
+	assert.Contains(t, string(out), "1 to create, 0 to update")
+	_, err = cms.Get(ctx, "confirmed", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "nothing is applied without confirmation")
+
+	confirmed := exec.Command("katomik", "apply", "-f", path, "--protected-contexts", "*")
+	confirmed.Stdin = strings.NewReader("yes\n")
+	out, err = confirmed.CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.NoError(t, err)
+
+	out, err = exec.Command("katomik", "apply", "-f", path, "--protected-contexts", "*", "--yes").CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "Type \"yes\"")
+}
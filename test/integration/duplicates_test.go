@@ -0,0 +1,66 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashmap-kz/katomik/internal/apply"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func writeDuplicateConfigMaps(t *testing.T, name string) string {
+	t.Helper()
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "a.yaml"), []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: `+name+`
+data:
+  a: "1"
+`), 0o644))
+	// same object, namespace only differs by defaulting
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "b.yaml"), []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: `+name+`
+  namespace: default
+data:
+  b: "2"
+`), 0o644))
+	return tmp
+}
+
+func TestDuplicatesRejected(t *testing.T) {
+	dir := writeDuplicateConfigMaps(t, "dup-rejected")
+
+	out, err := exec.Command("katomik", "apply", "-f", dir, "--timeout", "30s").CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.Error(t, err)
+	assert.Equal(t, apply.ExitPlan, exitCode(err))
+	assert.Contains(t, string(out), "a.yaml:2 (doc 1)")
+	assert.Contains(t, string(out), "b.yaml:2 (doc 1)")
+
+	_, err = kubeClient(t).CoreV1().ConfigMaps("default").Get(context.Background(), "dup-rejected", metav1.GetOptions{})
+	assert.Error(t, err)
+}
+
+func TestDuplicatesMerged(t *testing.T) {
+	dir := writeDuplicateConfigMaps(t, "dup-merged")
+
+	out, err := exec.Command("katomik", "apply", "-f", dir, "--timeout", "30s", "--duplicates", "merge").CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.NoError(t, err)
+
+	cm, err := kubeClient(t).CoreV1().ConfigMaps("default").Get(context.Background(), "dup-merged", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, cm.Data)
+}
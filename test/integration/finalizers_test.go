@@ -0,0 +1,71 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashmap-kz/katomik/internal/apply"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// writeFinalizedRelease writes a ConfigMap held by a finalizer nobody
+// removes, followed by an invalid object so the apply is rolled back.
+func writeFinalizedRelease(t *testing.T, name string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "release.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: `+name+`
+  finalizers:
+    - example.com/never-removed
+data:
+  a: "1"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: INVALID_NAME
+`), 0o644))
+	return path
+}
+
+func TestRollbackStuckFinalizer(t *testing.T) {
+	ctx := context.Background()
+	path := writeFinalizedRelease(t, "finalized-stuck")
+	t.Cleanup(func() {
+		cms := kubeClient(t).CoreV1().ConfigMaps("default")
+		_, _ = cms.Patch(ctx, "finalized-stuck", types.MergePatchType, []byte(`{"metadata":{"finalizers":null}}`), metav1.PatchOptions{})
+		_ = cms.Delete(ctx, "finalized-stuck", metav1.DeleteOptions{})
+	})
+
+	out, err := exec.Command("katomik", "apply", "-f", path, "--validate=false", "--timeout", "5s").CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.Error(t, err)
+	assert.Equal(t, apply.ExitRollbackFailed, exitCode(err))
+	assert.Contains(t, string(out), "waiting for finalizers example.com/never-removed")
+}
+
+func TestRollbackForceFinalizers(t *testing.T) {
+	path := writeFinalizedRelease(t, "finalized-forced")
+
+	out, err := exec.Command("katomik", "apply", "-f", path, "--validate=false", "--timeout", "5s",
+		"--force-finalizers", "--rollback-propagation", "foreground").CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.Error(t, err)
+	assert.Equal(t, apply.ExitRolledBack, exitCode(err))
+	assert.Contains(t, string(out), "clearing finalizers of ConfigMap/finalized-forced")
+
+	_, err = kubeClient(t).CoreV1().ConfigMaps("default").Get(context.Background(), "finalized-forced", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
@@ -0,0 +1,63 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashmap-kz/katomik/internal/apply"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNoRollbackKeepsChangesUntilRollback(t *testing.T) {
+	ctx := context.Background()
+	cms := kubeClient(t).CoreV1().ConfigMaps("default")
+	t.Cleanup(func() {
+		_ = cms.Delete(ctx, "kept-created", metav1.DeleteOptions{})
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "release.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kept-created
+data:
+  a: "1"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: INVALID_NAME
+`), 0o644))
+	plan := filepath.Join(dir, "rollback.json")
+
+	out, err := exec.Command("katomik", "apply", "-f", path, "--validate=false",
+		"--no-rollback", "--rollback-plan", plan).CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.Error(t, err)
+	assert.Equal(t, apply.ExitNotRolledBack, exitCode(err))
+	assert.Contains(t, string(out), "katomik rollback --plan "+plan)
+
+	_, err = cms.Get(ctx, "kept-created", metav1.GetOptions{})
+	require.NoError(t, err, "created object must be kept")
+	fi, err := os.Stat(plan)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	out, err = exec.Command("katomik", "rollback", "--plan", plan).CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "rollback verified")
+
+	_, err = cms.Get(ctx, "kept-created", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "created object must be deleted by the rollback")
+}
@@ -0,0 +1,125 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashmap-kz/katomik/internal/apply"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func writeRuledConfigMap(t *testing.T, name, state string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name+".yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: `+name+`
+  annotations:
+    katomik.io/ready-when: jsonpath={.data.state}=ok
+    katomik.io/failed-when: jsonpath={.data.state}=broken
+data:
+  state: `+state+`
+`), 0o644))
+	return path
+}
+
+func TestReadinessRuleReady(t *testing.T) {
+	path := writeRuledConfigMap(t, "ready-when-ok", "ok")
+	t.Cleanup(func() {
+		_ = kubeClient(t).CoreV1().ConfigMaps("default").Delete(context.Background(), "ready-when-ok", metav1.DeleteOptions{})
+	})
+
+	out, err := exec.Command("katomik", "apply", "-f", path, "--timeout", "30s").CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.NoError(t, err)
+}
+
+func TestReadinessRuleFailedRollsBack(t *testing.T) {
+	path := writeRuledConfigMap(t, "failed-when-broken", "broken")
+
+	start := time.Now()
+	out, err := exec.Command("katomik", "apply", "-f", path, "--timeout", "2m").CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.Error(t, err)
+	assert.Equal(t, apply.ExitReadinessRolledBack, exitCode(err))
+	assert.Contains(t, string(out), "failed-when jsonpath={.data.state}=broken matched")
+	// failing does not wait for the timeout
+	assert.Less(t, time.Since(start), time.Minute)
+
+	_, err = kubeClient(t).CoreV1().ConfigMaps("default").Get(context.Background(), "failed-when-broken", metav1.GetOptions{})
+	assert.Error(t, err, "created object must be rolled back")
+}
+
+func TestReadinessRuleInvalid(t *testing.T) {
+	path := writeRuledConfigMap(t, "ready-when-invalid", "ok")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(
+		string(data)+"---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: typo\n  annotations:\n    katomik.io/ready-when: phase=Running\n",
+	), 0o644))
+
+	out, err := exec.Command("katomik", "apply", "-f", path).CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.Error(t, err)
+	assert.Equal(t, apply.ExitInput, exitCode(err))
+	assert.Contains(t, string(out), "(doc 2)")
+}
+
+func TestWaitOptOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "never-ready.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: wait-opt-out
+  annotations:
+    katomik.io/ready-when: jsonpath={.data.state}=ok
+    katomik.io/wait: "false"
+data:
+  state: pending
+`), 0o644))
+	t.Cleanup(func() {
+		_ = kubeClient(t).CoreV1().ConfigMaps("default").Delete(context.Background(), "wait-opt-out", metav1.DeleteOptions{})
+	})
+
+	out, err := exec.Command("katomik", "apply", "-f", path, "--timeout", "10s").CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "not waiting for ConfigMap/wait-opt-out")
+}
+
+func TestPerResourceTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slow.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: per-resource-timeout
+  annotations:
+    katomik.io/ready-when: jsonpath={.data.state}=ok
+    katomik.io/timeout: 5s
+data:
+  state: pending
+`), 0o644))
+
+	start := time.Now()
+	out, err := exec.Command("katomik", "apply", "-f", path, "--timeout", "5m").CombinedOutput()
+	t.Logf("Output:\n%s", string(out))
+	require.Error(t, err)
+	assert.Equal(t, apply.ExitReadinessRolledBack, exitCode(err))
+	assert.Contains(t, string(out), "resource not ready within 5s: ConfigMap/per-resource-timeout")
+	assert.Less(t, time.Since(start), time.Minute)
+
+	_, err = kubeClient(t).CoreV1().ConfigMaps("default").Get(context.Background(), "per-resource-timeout", metav1.GetOptions{})
+	assert.Error(t, err, "created object must be rolled back")
+}
@@ -0,0 +1,90 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashmap-kz/katomik/internal/apply"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const restartDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: restart-app
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: restart-app
+  template:
+    metadata:
+      labels:
+        app: restart-app
+    spec:
+      containers:
+        - name: nginx
+          image: nginx:latest
+          envFrom:
+            - configMapRef:
+                name: restart-config
+`
+
+func writeRestartConfig(t *testing.T, dir, value string) string {
+	t.Helper()
+	path := filepath.Join(dir, "config-"+value+".yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: restart-config
+data:
+  VALUE: `+value+`
+`), 0o644))
+	return path
+}
+
+func TestRestartOnConfigChange(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+	t.Cleanup(func() {
+		_ = kubeClient(t).AppsV1().Deployments("default").Delete(ctx, "restart-app", metav1.DeleteOptions{})
+		_ = kubeClient(t).CoreV1().ConfigMaps("default").Delete(ctx, "restart-config", metav1.DeleteOptions{})
+	})
+
+	deployPath := filepath.Join(tmp, "deploy.yaml")
+	require.NoError(t, os.WriteFile(deployPath, []byte(restartDeployment), 0o644))
+	out, err := exec.Command("katomik", "apply", "-f", writeRestartConfig(t, tmp, "one"), "-f", deployPath, "--timeout", "2m").CombinedOutput()
+	t.Logf("first apply output:\n%s", string(out))
+	require.NoError(t, err)
+
+	restartedAt := func() string {
+		d, err := kubeClient(t).AppsV1().Deployments("default").Get(ctx, "restart-app", metav1.GetOptions{})
+		require.NoError(t, err)
+		return d.Spec.Template.Annotations[apply.AnnotationRestartedAt]
+	}
+	require.Empty(t, restartedAt())
+
+	// only the ConfigMap is in the manifests, the Deployment is found in the cluster
+	out, err = exec.Command("katomik", "apply", "-f", writeRestartConfig(t, tmp, "two"), "--timeout", "2m").CombinedOutput()
+	t.Logf("second apply output:\n%s", string(out))
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "restarting Deployment/restart-app: uses changed ConfigMap/restart-config")
+	restarted := restartedAt()
+	assert.NotEmpty(t, restarted)
+
+	// applying the same content again restarts nothing
+	out, err = exec.Command("katomik", "apply", "-f", writeRestartConfig(t, tmp, "two"), "-f", deployPath, "--timeout", "2m").CombinedOutput()
+	t.Logf("third apply output:\n%s", string(out))
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "restarting")
+	assert.Equal(t, restarted, restartedAt())
+}
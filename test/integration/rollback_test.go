@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hashmap-kz/katomik/internal/apply"
 	"github.com/stretchr/testify/require"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -75,6 +76,8 @@ data:
 	out, err = cmd.CombinedOutput()
 	t.Logf("second apply output (expected failure):\n%s", string(out))
 	require.Error(t, err, "second apply must fail to invoke rollback")
+	require.Equal(t, apply.ExitRolledBack, exitCode(err), "failed apply must report a clean rollback")
+	require.Contains(t, string(out), "rollback verified")
 
 	// 3. Verify rollback
 	cm, err = cmResource(dyn).Namespace("default").
@@ -85,9 +88,10 @@ data:
 	require.Equal(t, "bar", cm.Object["data"].(map[string]interface{})["foo"],
 		"ConfigMap data should have been rolled back")
 
-	// resourceVersion *advanced* (write occurred) but object is otherwise identical
-	require.Greater(t, cm.GetResourceVersion(), initialRV,
-		"RV should bump after rollback update")
+	// resourceVersion changed (write occurred) but object is otherwise identical;
+	// resourceVersions are opaque, only (in)equality is meaningful
+	require.NotEqual(t, initialRV, cm.GetResourceVersion(),
+		"RV should change after rollback update")
 
 	// The invalid object never persisted
 	_, err = cmResource(dyn).Namespace("default").
@@ -95,4 +99,47 @@ data:
 	require.Error(t, err, "invalid ConfigMap must not exist after rollback")
 }
 
+func TestRollbackLeavesUnchangedObjects(t *testing.T) {
+	tmp := t.TempDir()
+	okFile := filepath.Join(tmp, "ok.yaml")
+	badFile := filepath.Join(tmp, "bad.yaml")
+	unchanged := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: untouched
+data:
+  foo: bar
+`
+	require.NoError(t, os.WriteFile(okFile, []byte(unchanged), 0o644))
+	t.Cleanup(func() {
+		_ = cmResource(dynClient(t)).Namespace("default").Delete(context.TODO(), "untouched", metav1.DeleteOptions{})
+	})
+
+	out, err := exec.Command("katomik", "apply", "-f", okFile, "--timeout", "10s").CombinedOutput()
+	t.Logf("first apply output:\n%s", string(out))
+	require.NoError(t, err)
+	cm, err := cmResource(dynClient(t)).Namespace("default").Get(context.TODO(), "untouched", metav1.GetOptions{})
+	require.NoError(t, err)
+	initialRV := cm.GetResourceVersion()
+
+	// the same object again, along with one that fails
+	require.NoError(t, os.WriteFile(badFile, []byte(unchanged+`
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: INVALID_NAME
+`), 0o644))
+	out, err = exec.Command("katomik", "apply", "-f", badFile, "--timeout", "10s").CombinedOutput()
+	t.Logf("second apply output (expected failure):\n%s", string(out))
+	require.Error(t, err)
+	require.Equal(t, apply.ExitRolledBack, exitCode(err))
+	require.Contains(t, string(out), "= unchanged ConfigMap/untouched")
+
+	cm, err = cmResource(dynClient(t)).Namespace("default").Get(context.TODO(), "untouched", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, initialRV, cm.GetResourceVersion(), "unchanged objects are neither applied nor rolled back")
+}
+
 func init() { time.Sleep(2 * time.Second) }
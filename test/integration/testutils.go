@@ -1,6 +1,8 @@
 package integration
 
 import (
+	"errors"
+	"os/exec"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,6 +13,16 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// exitCode returns the exit code of a finished katomik command, -1 if err
+// is not an exit status.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
 func kubeConfig() (*rest.Config, error) {
 	cfg, err := k()
 	if err != nil {
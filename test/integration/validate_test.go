@@ -0,0 +1,44 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashmap-kz/katomik/internal/apply"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateRejectsTypoBeforeApply(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	manifest := strings.ReplaceAll(baseDeployment, "test-nginx", "typo-nginx")
+	manifest = strings.ReplaceAll(manifest, "replicas: 1", "replica: 1")
+	path := filepath.Join(tmp, "typo.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(manifest), 0o644))
+
+	out, err := exec.Command("katomik", "validate", "-f", path).CombinedOutput()
+	t.Logf("validate output:\n%s", string(out))
+	require.Error(t, err)
+	assert.Equal(t, apply.ExitInput, exitCode(err))
+	assert.Contains(t, string(out), `spec.replica: unknown field "replica"`)
+	assert.Contains(t, string(out), "typo.yaml:2 (doc 1)")
+
+	out, err = exec.Command("katomik", "apply", "-f", path).CombinedOutput()
+	t.Logf("apply output:\n%s", string(out))
+	require.Error(t, err)
+	assert.Equal(t, apply.ExitInput, exitCode(err))
+
+	// nothing was touched
+	client := kubeClient(t)
+	_, err = client.AppsV1().Deployments("default").Get(ctx, "typo-nginx", metav1.GetOptions{})
+	assert.Error(t, err)
+}